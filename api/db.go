@@ -5,10 +5,22 @@ package api
 import "github.com/eja/tibula/db"
 
 type (
-	DbLink    = db.TypeLink
-	DbGroup   = db.TypeGroup
-	DbModule  = db.TypeModule
-	DbSession = db.TypeSession
+	DbLink                = db.TypeLink
+	DbGroup               = db.TypeGroup
+	DbModule              = db.TypeModule
+	DbCommand             = db.TypeCommand
+	DbFile                = db.TypeFile
+	DbSession             = db.TypeSession
+	DbSchemaDiff          = db.TypeSchemaDiff
+	DbDeleteRestricted    = db.TypeDeleteRestricted
+	DbSavedSearchCriteria = db.TypeSavedSearchCriteria
 )
 
 var DbProvider = db.Session
+var DbFileStore = db.FileStore
+var DbImageStore = db.ImageStore
+var DbErrImageNotValid = db.ErrImageNotValid
+var DbErrSearchNotPermitted = db.ErrSearchNotPermitted
+var DbContactNormalize = db.ContactNormalize
+
+const DbSearchDistance = db.SearchDistance
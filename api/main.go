@@ -3,10 +3,15 @@
 package api
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/eja/tibula/sys"
 )
@@ -22,13 +27,33 @@ func Set() Api {
 	}
 }
 
-func Run(eja Api, sessionSave bool) (Api, error) {
-	db := DbProvider()
+// Run processes a single request, pool is the long lived database handle
+// shared between requests, when missing a new one is opened and closed.
+func Run(eja Api, sessionSave bool, pool ...DbSession) (Api, error) {
+	return RunContext(context.Background(), eja, sessionSave, pool...)
+}
+
+// RunContext is like Run but every query is cancelled as soon as ctx is done.
+func RunContext(ctx context.Context, eja Api, sessionSave bool, pool ...DbSession) (Api, error) {
+	if len(pool) == 0 || pool[0].Handler == nil {
+		handle := DbProvider()
+		if err := handle.Open(sys.Options.DbType, sys.Options.DbName, sys.Options.DbUser, sys.Options.DbPass, sys.Options.DbHost, sys.Options.DbPort); err != nil {
+			return eja, err
+		}
+		defer handle.Close()
+		pool = []DbSession{handle}
+	}
 
-	if err := db.Open(sys.Options.DbType, sys.Options.DbName, sys.Options.DbUser, sys.Options.DbPass, sys.Options.DbHost, sys.Options.DbPort); err != nil {
+	handle := pool[0].WithContext(ctx)
+	db, err := handle.Conn()
+	if err != nil {
 		return eja, err
 	}
 	defer db.Close()
+	db.RemoteIp = eja.RemoteIP
+	if sys.Options.DbQueryTimeout > 0 {
+		db.QueryTimeout = time.Duration(sys.Options.DbQueryTimeout) * time.Second
+	}
 
 	eja = runAuthPipeline(eja, db)
 
@@ -134,6 +159,8 @@ func runStatePipeline(eja Api, db DbSession) Api {
 				eja.SearchOffset = db.Number(row["value"])
 			case "SqlQuery64":
 				eja.SqlQuery64 = row["value"]
+			case "Trash":
+				eja.Trash = row["value"] == "1"
 			case "SqlQueryArgs":
 				eja.SqlQueryArgs = append(eja.SqlQueryArgs, row["value"])
 			case "Link":
@@ -149,11 +176,16 @@ func runStatePipeline(eja Api, db DbSession) Api {
 		}
 	}
 
+	if eja.SearchId > 0 {
+		eja = savedSearchApply(eja, db)
+	}
+
 	if eja.Action == "" && db.AutoSearch(eja.ModuleId) {
 		eja.SearchOffset = 0
 		eja.SearchOrder = map[string]string{}
 		eja.ActionType = "List"
 		eja.SqlQuery64 = ""
+		eja.Trash = false
 	}
 	return eja
 }
@@ -213,6 +245,21 @@ func runDataPipeline(eja Api, db DbSession) Api {
 	case "edit":
 		if eja.Id > 0 {
 			eja.Values = db.TableGetAllById(eja.ModuleName, eja.Id)
+			if eja.FieldFile != "" {
+				file, err := db.FileGet(eja.Owner, eja.ModuleId, eja.Id, eja.FieldFile)
+				if err != nil {
+					slog.Warn("file", "module", eja.ModuleName, "id", eja.Id, "field", eja.FieldFile, "error", err)
+					eja.alert(db.Translate("ejaFileNotFound", eja.Owner))
+				} else if eja.FileThumb {
+					if file.Thumb == "" {
+						file = DbFile{}
+						eja.alert(db.Translate("ejaFileNotFound", eja.Owner))
+					} else {
+						file = file.ThumbFile()
+					}
+				}
+				eja.File = file
+			}
 		}
 	case "new", "copy":
 		oldId := eja.Id
@@ -227,8 +274,23 @@ func runDataPipeline(eja Api, db DbSession) Api {
 		if len(ids) == 0 && eja.Id > 0 {
 			ids = []int64{eja.Id}
 		}
+		if eja.ModuleName == "ejaFields" && !eja.Confirm {
+			for _, vid := range ids {
+				if diff, err := db.SchemaDiff(vid, 0, "", "", ""); err == nil && diff.Destructive() {
+					eja.Confirmations = append(eja.Confirmations, schemaConfirmation(db, eja.Owner, diff))
+				}
+			}
+			if len(eja.Confirmations) > 0 {
+				eja.alert(db.Translate("ejaSchemaConfirm", eja.Owner))
+				ids = nil
+			}
+		}
 		for _, vid := range ids {
 			err := db.Del(eja.Owner, eja.ModuleId, vid)
+			var restricted DbDeleteRestricted
+			if errors.As(err, &restricted) {
+				eja.alert(fmt.Sprintf("%s: %d", db.Translate(restricted.Error(), eja.Owner), restricted.Count))
+			}
 			if eja.ModuleName == "ejaModules" {
 				msg := "ejaSqlModuleDeleteTrue"
 				if err != nil {
@@ -240,9 +302,40 @@ func runDataPipeline(eja Api, db DbSession) Api {
 			}
 		}
 		eja.ActionType = "List"
+	case "trash":
+		eja.Trash, eja.SqlQuery64, eja.SqlQueryArgs, eja.SearchOffset = true, "", nil, 0
+		db.SessionCleanSearch(eja.Owner)
+		eja.ActionType = "List"
+	case "restore", "purge":
+		for _, vid := range eja.IdList {
+			var err error
+			if eja.Action == "restore" {
+				err = db.Restore(eja.Owner, eja.ModuleId, vid)
+			} else {
+				err = db.Purge(eja.Owner, eja.ModuleId, vid)
+			}
+			if err != nil {
+				slog.Error(eja.Action, "module", eja.ModuleName, "id", vid, "error", err)
+				eja.alert(db.Translate("ejaSaveError", eja.Owner))
+			}
+		}
+		eja.ActionType = "List"
+	case "history":
+		if eja.Id > 0 {
+			if eja.AuditId > 0 {
+				if err := db.AuditRestore(eja.Owner, eja.ModuleId, eja.Id, eja.AuditId, eja.AuditVersion); err != nil {
+					slog.Error("history", "module", eja.ModuleName, "id", eja.Id, "audit", eja.AuditId, "error", err)
+					eja.alert(db.Translate("ejaSaveError", eja.Owner))
+				} else {
+					eja.info(db.Translate("ejaAuditRestored", eja.Owner))
+				}
+			}
+			eja.History, _ = db.AuditHistory(eja.Owner, eja.ModuleId, eja.Id)
+			eja.Values = db.TableGetAllById(eja.ModuleName, eja.Id)
+		}
 	}
 
-	if len(eja.Values) > 0 && (eja.Action == "save" || eja.Action == "copy" || eja.Action == "new") {
+	if (len(eja.Values) > 0 || len(eja.Uploads) > 0) && (eja.Action == "save" || eja.Action == "copy" || eja.Action == "new") {
 		eja = handleSave(eja, db)
 	}
 
@@ -257,15 +350,136 @@ func runDataPipeline(eja Api, db DbSession) Api {
 	return eja
 }
 
+// handleSave writes the whole record in a single transaction, on failure
+// nothing is stored and eja is returned as it was with an alert.
 func handleSave(eja Api, db DbSession) Api {
-	if eja.ModuleName == "ejaModules" {
-		if db.Number(eja.Values["sqlCreated"]) > 0 {
-			if err := db.TableAdd(eja.Values["name"]); err != nil {
-				eja.alert(db.Translate("ejaSqlModuleNotCreated", eja.Owner))
+	saved := eja
+	err := db.WithTx(func(tx *DbSession) error {
+		var err error
+		eja, err = saveRecord(eja, *tx)
+		return err
+	})
+	if err != nil {
+		confirmations, fieldErrors, conflicts := eja.Confirmations, eja.FieldErrors, eja.Conflicts
+		eja = saved
+		eja.Confirmations, eja.FieldErrors, eja.Conflicts = confirmations, fieldErrors, conflicts
+		if len(conflicts) > 0 {
+			eja.alert(db.Translate(err.Error(), eja.Owner) + ": " + conflictFields(db, eja.Owner, conflicts))
+		} else {
+			eja.alert(db.Translate(err.Error(), eja.Owner))
+		}
+		return eja
+	}
+
+	if res, err := db.Get(eja.Owner, eja.ModuleId, eja.Id); err == nil {
+		eja.Values = res
+	}
+	return eja
+}
+
+func saveRecord(eja Api, db DbSession) (Api, error) {
+	for name, upload := range eja.Uploads {
+		var file DbFile
+		var err error
+		switch db.FieldTypeGet(eja.ModuleId, name) {
+		case "file":
+			file, err = fileUpload(upload)
+		case "image":
+			if file, err = imageUpload(upload); errors.Is(err, DbErrImageNotValid) {
+				slog.Warn("upload", "module", eja.ModuleName, "field", name, "error", err)
+				eja.FieldErrors = map[string]string{name: db.Translate("ejaValidateImage", eja.Owner)}
+				return eja, errors.New("ejaValidateError")
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			slog.Error("upload", "module", eja.ModuleName, "field", name, "error", err)
+			return eja, errors.New("ejaSaveError")
+		}
+		eja.Values[name] = file.String()
+	}
+
+	language := ""
+	var stored map[string]string
+	for name, value := range eja.Values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		fieldError := ""
+		switch fieldType := db.FieldTypeGet(eja.ModuleId, name); fieldType {
+		case "money":
+			if language == "" {
+				language = db.UserLanguage(eja.Owner)
+			}
+			if amount, ok := db.MoneyGet(eja.ModuleId, name).Parse(value, language); ok {
+				eja.Values[name] = db.String(amount)
 			} else {
-				eja.info(db.Translate("ejaSqlModuleCreated", eja.Owner))
+				fieldError = "ejaValidateMoney"
+			}
+		case "file", "image":
+			// attachments can only be kept as stored or replaced by an upload of this request
+			if _, uploaded := eja.Uploads[name]; !uploaded {
+				if stored == nil {
+					stored, _ = db.Get(eja.Owner, eja.ModuleId, eja.Id)
+				}
+				if value != stored[name] {
+					fieldError = "ejaValidate" + strings.ToUpper(fieldType[:1]) + fieldType[1:]
+				}
+			}
+		case "reference":
+			if _, ok := db.ReferenceLabel(eja.Owner, eja.ModuleId, name, db.Number(value)); !ok {
+				fieldError = "ejaValidateReference"
 			}
+		case "email", "url", "phone":
+			if normalized, ok := DbContactNormalize(fieldType, value); ok {
+				eja.Values[name] = normalized
+			} else {
+				fieldError = "ejaValidate" + strings.ToUpper(fieldType[:1]) + fieldType[1:]
+			}
+		}
+		if fieldError != "" {
+			eja.FieldErrors = map[string]string{name: db.Translate(fieldError, eja.Owner)}
+			return eja, errors.New("ejaValidateError")
+		}
+	}
+
+	if eja.Action == "save" && eja.Id > 0 && eja.Version != "" {
+		conflicts, err := db.Conflicts(eja.Owner, eja.ModuleId, eja.Id, eja.Version, eja.Values)
+		if err != nil {
+			slog.Error("conflicts", "module", eja.ModuleName, "id", eja.Id, "error", err)
+			return eja, errors.New("ejaSaveError")
+		}
+		if len(conflicts) > 0 {
+			eja.Conflicts = conflicts
+			return eja, errors.New("ejaSaveConflict")
 		}
+	}
+
+	if errs, err := db.Validate(eja.ModuleId, eja.Id, eja.Values); err != nil {
+		slog.Error("validate", "module", eja.ModuleName, "error", err)
+		return eja, errors.New("ejaSaveError")
+	} else if errs != nil {
+		eja.FieldErrors = make(map[string]string, len(errs))
+		for name, fieldError := range errs {
+			eja.FieldErrors[name] = strings.TrimSpace(db.Translate(fieldError.Word, eja.Owner) + " " + fieldError.Limit)
+		}
+		return eja, errors.New("ejaValidateError")
+	}
+
+	if eja.ModuleName == "ejaSearches" {
+		// searches stay on modules their owner can search and are only shared with its groups
+		if stored == nil {
+			stored, _ = db.Get(eja.Owner, eja.ModuleId, eja.Id)
+		}
+		search := map[string]string{"ejaModuleId": stored["ejaModuleId"], "ejaGroupId": stored["ejaGroupId"]}
+		maps.Copy(search, eja.Values)
+		if err := db.SavedSearchCheck(eja.Owner, db.Number(search["ejaModuleId"]), db.Number(search["ejaGroupId"])); err != nil {
+			return eja, err
+		}
+	}
+
+	if eja.ModuleName == "ejaModules" {
 		if eja.Action == "save" && db.PermissionCount(eja.Id) == 0 {
 			if db.Number(eja.Values["sqlCreated"]) > 0 {
 				db.PermissionAddDefault(eja.Owner, eja.Id)
@@ -278,12 +492,30 @@ func handleSave(eja Api, db DbSession) Api {
 		}
 	}
 
+	var diff DbSchemaDiff
 	if eja.ModuleName == "ejaFields" {
-		moduleName := db.ModuleGetNameById(db.Number(eja.Values["ejaModuleId"]))
-		if err := db.FieldAdd(moduleName, eja.Values["name"], eja.Values["type"]); err == nil {
-			eja.info(db.Translate("ejaSqlFieldCreated", eja.Owner))
-		} else {
-			eja.alert(db.Translate("ejaSqlFieldNotCreated", eja.Owner))
+		if eja.Values["type"] == "formula" {
+			if err := db.FormulaCheck(db.Number(eja.Values["ejaModuleId"]), eja.Values["name"], eja.Values["value"]); err != nil {
+				slog.Warn("formula", "field", eja.Values["name"], "error", err)
+				eja.FieldErrors = map[string]string{"value": db.Translate("ejaFormulaError", eja.Owner) + ": " + err.Error()}
+				return eja, errors.New("ejaFormulaError")
+			}
+		}
+		if eja.Values["type"] == "reference" {
+			if err := db.ReferenceCheck(eja.Values["value"]); err != nil {
+				slog.Warn("reference", "field", eja.Values["name"], "error", err)
+				eja.FieldErrors = map[string]string{"value": db.Translate("ejaReferenceError", eja.Owner) + ": " + err.Error()}
+				return eja, errors.New("ejaReferenceError")
+			}
+		}
+		var err error
+		if diff, err = db.SchemaDiff(eja.Id, db.Number(eja.Values["ejaModuleId"]), eja.Values["name"], eja.Values["type"], eja.Values["sqlIndex"]); err != nil {
+			slog.Error("schema diff", "field", eja.Values["name"], "error", err)
+			return eja, errors.New("ejaSqlFieldNotCreated")
+		}
+		if diff.Destructive() && !eja.Confirm {
+			eja.Confirmations = append(eja.Confirmations, schemaConfirmation(db, eja.Owner, diff))
+			return eja, errors.New("ejaSchemaConfirm")
 		}
 	}
 
@@ -294,43 +526,92 @@ func handleSave(eja Api, db DbSession) Api {
 	}
 
 	if eja.Id < 1 {
-		eja.alert(db.Translate("ejaErrorEditId", eja.Owner))
-		return eja
+		return eja, errors.New("ejaErrorEditId")
 	}
 
+	var ignored []string
 	for k, v := range eja.Values {
+		fieldType := db.FieldTypeGet(eja.ModuleId, k)
+		if check, err := db.FieldExists(eja.ModuleName, k); err != nil {
+			slog.Error("save", "module", eja.ModuleName, "id", eja.Id, "field", k, "error", err)
+			return eja, errors.New("ejaSaveError")
+		} else if !check {
+			if fieldType != "label" && fieldType != "sqlValue" && fieldType != "formula" {
+				ignored = append(ignored, k)
+			}
+			continue
+		}
 		var val any
-		switch db.FieldTypeGet(eja.ModuleId, k) {
+		switch fieldType {
 		case "password":
 			val = v
 			if len(v) != 60 && len(v) != 64 { // bcrypt/sha256
 				val = db.Password(v)
 			}
-		case "boolean", "integer":
+		case "boolean", "integer", "money", "reference":
 			val = db.Number(v)
 		case "decimal":
 			val = db.Float(v)
+		case "json":
+			if val = v; strings.TrimSpace(v) == "" {
+				val = nil
+			}
 		default:
 			val = db.String(v)
 		}
 
 		if k == "ejaOwner" && db.Number(v) < 1 {
-			db.Put(eja.Owner, eja.ModuleId, eja.Id, k, eja.Owner)
+			val = eja.Owner
+		}
+		if err := db.Put(eja.Owner, eja.ModuleId, eja.Id, k, val); err != nil {
+			slog.Error("save", "module", eja.ModuleName, "id", eja.Id, "field", k, "error", err)
+			return eja, errors.New("ejaSaveError")
+		}
+	}
+
+	if len(ignored) > 0 {
+		slices.Sort(ignored)
+		slog.Warn("save", "module", eja.ModuleName, "id", eja.Id, "ignored", ignored)
+		eja.alert(db.Translate("ejaFieldNotFound", eja.Owner) + ": " + strings.Join(ignored, ", "))
+	}
+
+	// schema changes come last, after every other write has succeeded, since
+	// MySQL commits them implicitly and a rollback would not undo them
+	if eja.ModuleName == "ejaModules" && db.Number(eja.Values["sqlCreated"]) > 0 {
+		if err := db.TableAdd(eja.Values["name"]); err != nil {
+			eja.alert(db.Translate("ejaSqlModuleNotCreated", eja.Owner))
 		} else {
-			db.Put(eja.Owner, eja.ModuleId, eja.Id, k, val)
+			eja.info(db.Translate("ejaSqlModuleCreated", eja.Owner))
 		}
 	}
 
-	if res, err := db.Get(eja.Owner, eja.ModuleId, eja.Id); err == nil {
-		eja.Values = res
+	if eja.ModuleName == "ejaModules" && db.Number(eja.Values["trash"]) > 0 {
+		if err := db.TrashEnable(eja.Owner, eja.Id); err != nil {
+			slog.Error("trash enable", "module", eja.Values["name"], "error", err)
+			return eja, errors.New("ejaSaveError")
+		}
 	}
-	return eja
+
+	if eja.ModuleName == "ejaFields" && !diff.Empty() {
+		if err := db.SchemaApply(diff); err != nil {
+			slog.Error("schema apply", "field", eja.Values["name"], "error", err)
+			return eja, errors.New("ejaSqlFieldNotCreated")
+		}
+		if diff.Add {
+			eja.info(db.Translate("ejaSqlFieldCreated", eja.Owner))
+		} else {
+			eja.info(db.Translate("ejaSqlFieldUpdated", eja.Owner))
+		}
+	}
+
+	return eja, nil
 }
 
 func handleSearch(eja Api, db DbSession, linkField string, sub ActiveSubModule) Api {
 	eja.ActionType = "List"
 	mDef := db.TableGetAllById("ejaModules", eja.ModuleId)
 
+	criteria := DbSavedSearchCriteria{Values: eja.Values, Filter: eja.Filter, SearchOrder: eja.SearchOrder, SearchLimit: eja.SearchLimit}
 	limit := eja.SearchLimit
 	if limit < 1 {
 		limit = db.Number(mDef["searchLimit"])
@@ -354,8 +635,27 @@ func handleSearch(eja Api, db DbSession, linkField string, sub ActiveSubModule)
 			sqlQuery = db.String(b)
 		}
 	} else {
-		var err error
-		sqlQuery, sqlArgs, err = db.SearchQuery(eja.Owner, eja.ModuleName, eja.Values)
+		var err, filterErr error
+		if eja.Trash {
+			sqlQuery, sqlArgs, err = db.SearchTrashQuery(eja.Owner, eja.ModuleName, eja.Values)
+			db.SessionPut(eja.Owner, "Trash", "1")
+		} else {
+			sqlQuery, sqlArgs, err = db.SearchQuery(eja.Owner, eja.ModuleName, eja.Values)
+		}
+		if err == nil && eja.Filter != nil {
+			var filterQuery string
+			var filterArgs []any
+			filterQuery, filterArgs, filterErr = db.SearchFilter(eja.Owner, eja.ModuleName, *eja.Filter)
+			if filterErr != nil {
+				eja.alert(db.Translate("ejaFilterError", eja.Owner) + ": " + filterErr.Error())
+				filterQuery = " AND 1=0 "
+			}
+			sqlQuery += filterQuery
+			sqlArgs = append(sqlArgs, filterArgs...)
+		}
+		if err == nil && filterErr == nil && eja.SearchName != "" {
+			eja = savedSearchSave(eja, db, criteria)
+		}
 		if err == nil {
 			eja.SqlQuery64 = base64.StdEncoding.EncodeToString([]byte(sqlQuery))
 			eja.SqlQueryArgs = sqlArgs
@@ -367,7 +667,11 @@ func handleSearch(eja Api, db DbSession, linkField string, sub ActiveSubModule)
 	}
 
 	var sqlOrder string
-	for _, key := range db.FieldNameList(eja.ModuleId, "List") {
+	orderKeys := db.FieldNameList(eja.ModuleId, "List")
+	if strings.Contains(sqlQuery, " AS "+DbSearchDistance+" ") {
+		orderKeys = append(orderKeys, DbSearchDistance)
+	}
+	for _, key := range orderKeys {
 		if db.FieldNameIsValid(key) != nil {
 			continue
 		}
@@ -387,6 +691,11 @@ func handleSearch(eja Api, db DbSession, linkField string, sub ActiveSubModule)
 		}
 	}
 
+	if sub.Found && sub.Item.FieldId > 0 {
+		sqlQuery += fmt.Sprintf(" AND %s=? ", sub.Item.FieldName)
+		eja.SqlQueryArgs = append(eja.SqlQueryArgs, db.String(sub.Item.FieldId))
+	}
+
 	sqlLinks := ""
 	if linkField != "" {
 		sqlLinks = fmt.Sprintf(" AND %s=? ", linkField)
@@ -395,13 +704,12 @@ func handleSearch(eja Api, db DbSession, linkField string, sub ActiveSubModule)
 		sqlLinks = db.SearchQueryLinks(eja.Owner, eja.Link.ModuleId, eja.Link.FieldId, eja.ModuleId)
 	}
 
-	if sub.Found && sub.Item.FieldId > 0 {
-		sqlQuery += fmt.Sprintf(" AND %s=%d ", sub.Item.FieldName, sub.Item.FieldId)
-	}
-
 	eja.SqlQuery = sqlQuery + sqlLinks + db.SearchQueryOrderAndLimit(sqlOrder, eja.SearchLimit, eja.SearchOffset)
-	eja.SearchCount = db.SearchCount(sqlQuery+sqlLinks, eja.SqlQueryArgs)
+	eja.SearchResult, eja.SearchLabels, eja.SearchCount, _ = db.SearchPage(eja.Owner, eja.ModuleId, sqlQuery+sqlLinks, sqlOrder, eja.SearchLimit, eja.SearchOffset, eja.SqlQueryArgs)
 	eja.SearchLast = min(eja.SearchOffset+eja.SearchLimit, eja.SearchCount)
+	if eja.SearchCount > 0 {
+		eja.SearchTotals = db.SearchTotals(eja.Owner, eja.ModuleId, sqlQuery+sqlLinks, eja.SqlQueryArgs)
+	}
 
 	db.SessionPut(eja.Owner, "SearchLimit", db.String(eja.SearchLimit))
 	db.SessionPut(eja.Owner, "SearchOffset", db.String(eja.SearchOffset))
@@ -420,9 +728,16 @@ func wrapUp(eja Api, db DbSession, sessionSave bool) Api {
 	eja.ModuleLabel = db.Translate(eja.ModuleName, eja.Owner)
 
 	if eja.ActionType == "List" {
-		eja.SearchRows, eja.SearchCols, eja.SearchLabels, _ = db.SearchMatrix(eja.Owner, eja.ModuleId, eja.SqlQuery, eja.SqlQueryArgs)
+		if eja.SearchResult.Columns == nil {
+			eja.SearchResult, eja.SearchLabels, _ = db.SearchResult(eja.Owner, eja.ModuleId, eja.SqlQuery, eja.SqlQueryArgs)
+		}
+		eja.SearchRows, eja.SearchCols = eja.SearchResult.Maps(), eja.SearchResult.Cols()
 	} else if eja.Id > 0 {
 		eja.ActionType = "Edit"
+		eja.Version, _ = db.Version(eja.Owner, eja.ModuleId, eja.Id)
+		if eja.TypedValues {
+			eja.Record, _ = db.GetRecord(eja.Owner, eja.ModuleId, eja.Id)
+		}
 		eja.Links = db.ModuleLinks(eja.Owner, eja.ModuleId)
 		eja.SubModules = db.SubModules(eja.Owner, eja.ModuleId)
 		db.SessionPut(eja.Owner, "ejaId", db.String(eja.Id))
@@ -432,14 +747,27 @@ func wrapUp(eja Api, db DbSession, sessionSave bool) Api {
 	}
 
 	eja.Commands, _ = db.Commands(eja.Owner, eja.ModuleId, eja.ActionType)
+	if eja.ActionType == "List" {
+		eja.Commands = trashCommands(eja.Commands, eja.Trash)
+	}
 	eja.Fields, _ = db.Fields(eja.Owner, eja.ModuleId, eja.ActionType, eja.Values)
+	if eja.ActionType == "Edit" {
+		eja = moneyValues(eja, db)
+	}
 	eja.Path = db.ModulePath(eja.Owner, eja.ModuleId)
 	eja.Tree = db.ModuleTree(eja.Owner, eja.ModuleId, eja.Path)
+	if eja.ActionType == "List" {
+		eja.Searches = db.SavedSearches(eja.Owner, eja.ModuleId, false)
+	}
 
 	if plugin, ok := Plugins[eja.ModuleName]; ok {
 		eja = plugin(eja, db)
 	}
 
+	if errors.Is(db.Err(), context.DeadlineExceeded) {
+		eja.alert(db.Translate("ejaQueryTimeout", eja.Owner))
+	}
+
 	if eja.Owner > 0 && !sessionSave {
 		db.SessionReset(eja.Owner)
 	}
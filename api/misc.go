@@ -4,8 +4,16 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"maps"
+	"mime/multipart"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,6 +29,57 @@ func (a *Api) alert(value string) {
 	slog.Debug(value, "gui", "alert")
 }
 
+// schemaConfirmation describes a destructive schema change to the user.
+func schemaConfirmation(db DbSession, owner int64, diff DbSchemaDiff) string {
+	word := "ejaSchemaRetype"
+	if diff.Drop {
+		word = "ejaSchemaDrop"
+	}
+	return fmt.Sprintf("%s: %s.%s", db.Translate(word, owner), diff.Table, diff.Field)
+}
+
+// conflictFields lists the labels of the fields changed by someone else.
+func conflictFields(db DbSession, owner int64, conflicts map[string]string) string {
+	var labels []string
+	for name := range conflicts {
+		labels = append(labels, db.Translate(name, owner))
+	}
+	sort.Strings(labels)
+	return strings.Join(labels, ", ")
+}
+
+// fileUpload moves an uploaded file into the attachments storage.
+func fileUpload(upload *multipart.FileHeader) (DbFile, error) {
+	content, err := upload.Open()
+	if err != nil {
+		return DbFile{}, err
+	}
+	defer content.Close()
+	return DbFileStore(upload.Filename, upload.Header.Get("Content-Type"), content)
+}
+
+// imageUpload stores an uploaded image together with its thumbnail.
+func imageUpload(upload *multipart.FileHeader) (DbFile, error) {
+	content, err := upload.Open()
+	if err != nil {
+		return DbFile{}, err
+	}
+	defer content.Close()
+	return DbImageStore(upload.Filename, content)
+}
+
+// trashCommands keeps restore and purge for the trash list and hides the
+// commands that move records to it.
+func trashCommands(commands []DbCommand, trash bool) []DbCommand {
+	hidden := []string{"restore", "purge"}
+	if trash {
+		hidden = []string{"trash", "delete"}
+	}
+	return slices.DeleteFunc(commands, func(command DbCommand) bool {
+		return slices.Contains(hidden, command.Name)
+	})
+}
+
 func googleSsoEmail(token string) string {
 	resp, err := httpClient.Get("https://oauth2.googleapis.com/tokeninfo?id_token=" + token)
 	if err != nil {
@@ -38,3 +97,82 @@ func googleSsoEmail(token string) string {
 	}
 	return ""
 }
+
+// moneyValues writes the amounts of the money fields, stored in minor units,
+// as plain decimal numbers in Values and Record.
+func moneyValues(eja Api, db DbSession) Api {
+	for _, field := range eja.Fields {
+		if field.Type != "money" {
+			continue
+		}
+		money := db.MoneyGet(eja.ModuleId, field.Name)
+		if amount, err := strconv.ParseInt(eja.Values[field.Name], 10, 64); err == nil {
+			eja.Values[field.Name] = money.String(amount)
+		}
+		if amount, ok := eja.Record[field.Name].(int64); ok {
+			eja.Record[field.Name] = json.Number(money.String(amount))
+		}
+	}
+	return eja
+}
+
+// savedSearchApply replaces the search state with the criteria of the saved
+// search SearchId, which must belong to the current module.
+func savedSearchApply(eja Api, db DbSession) Api {
+	search, err := db.SavedSearchGet(eja.Owner, eja.SearchId)
+	if err == nil && search.ModuleId != eja.ModuleId {
+		err = errors.New("ejaSearchNotFound")
+	}
+	if err == nil && !db.CommandExists(eja.Commands, "search") {
+		err = errors.New("ejaNotPermitted")
+	}
+	if err != nil {
+		eja.alert(db.Translate(err.Error(), eja.Owner))
+		eja.SearchId = 0
+		return eja
+	}
+
+	db.SessionCleanSearch(eja.Owner)
+	eja.Action, eja.Trash = "search", false
+	eja.SqlQuery64, eja.SqlQueryArgs, eja.SearchOffset = "", nil, 0
+	eja.Values, eja.SearchOrder = make(map[string]string), make(map[string]string)
+	maps.Copy(eja.Values, search.Criteria.Values)
+	maps.Copy(eja.SearchOrder, search.Criteria.SearchOrder)
+	eja.Filter = search.Criteria.Filter
+	eja.SearchLimit = search.Criteria.SearchLimit
+	return eja
+}
+
+// savedSearchSave stores the criteria of the running search as SearchName.
+func savedSearchSave(eja Api, db DbSession, criteria DbSavedSearchCriteria) Api {
+	name := strings.TrimSpace(eja.SearchName)
+	if name == "" {
+		return eja
+	}
+	values := make(map[string]string)
+	for key, value := range criteria.Values {
+		if value != "" {
+			values[key] = value
+		}
+	}
+	order := make(map[string]string)
+	for key, value := range criteria.SearchOrder {
+		if value == "ASC" || value == "DESC" {
+			order[key] = value
+		}
+	}
+	criteria.Values, criteria.SearchOrder = values, order
+
+	id, err := db.SavedSearchSave(eja.Owner, eja.ModuleId, name, criteria)
+	if errors.Is(err, DbErrSearchNotPermitted) {
+		eja.alert(db.Translate(err.Error(), eja.Owner))
+		return eja
+	} else if err != nil {
+		slog.Error("search save", "module", eja.ModuleName, "name", eja.SearchName, "error", err)
+		eja.alert(db.Translate("ejaSaveError", eja.Owner))
+		return eja
+	}
+	eja.SearchId = id
+	eja.info(db.Translate("ejaSearchSaved", eja.Owner))
+	return eja
+}
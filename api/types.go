@@ -2,56 +2,150 @@
 
 package api
 
-import "github.com/eja/tibula/db"
+import (
+	"encoding/json"
+	"mime/multipart"
+
+	"github.com/eja/tibula/db"
+)
 
 type Api struct {
-	Action              string              `json:"Action,omitempty"`
-	ActionType          string              `json:"ActionType,omitempty"`
-	Alert               []string            `json:"Alert,omitempty"`
-	Commands            []db.TypeCommand    `json:"Commands,omitempty"`
-	DefaultSearchLimit  int64               `json:"DefaultSearchLimit,omitempty"`
-	DefaultSearchOrder  string              `json:"DefaultSearchOrder,omitempty"`
-	FieldNameList       []string            `json:"FieldNameList,omitempty"`
-	Fields              []db.TypeField      `json:"Fields,omitempty"`
-	Id                  int64               `json:"Id,omitempty"`
-	IdList              []int64             `json:"IdList,omitempty"`
-	Info                []string            `json:"Info,omitempty"`
-	Language            string              `json:"Language,omitempty"`
-	Link                db.TypeLink         `json:"Link"`
-	Linking             bool                `json:"Linking,omitempty"`
-	Links               []db.TypeLink       `json:"Links,omitempty"`
-	ModuleId            int64               `json:"ModuleId,omitempty"`
-	ModuleLabel         string              `json:"ModuleLabel,omitempty"`
-	ModuleName          string              `json:"ModuleName,omitempty"`
-	Owner               int64               `json:"-"`
-	Path                []db.TypeModulePath `json:"Path,omitempty"`
-	SearchCols          []string            `json:"SearchCols,omitempty"`
-	SearchCount         int64               `json:"SearchCount,omitempty"`
-	SearchLabels        map[string]string   `json:"SearchLabels,omitempty"`
-	SearchLast          int64               `json:"SearchLast,omitempty"`
-	SearchLimit         int64               `json:"SearchLimit,omitempty"`
-	SearchLink          bool                `json:"SearchLink,omitempty"`
-	SearchLinkClean     bool                `json:"SearchLinkClean,omitempty"`
-	SearchLinks         []string            `json:"SearchLinks,omitempty"`
-	SearchOffset        int64               `json:"SearchOffset,omitempty"`
-	SearchOrder         map[string]string   `json:"SearchOrder,omitempty"`
-	SearchRows          db.TypeRows         `json:"SearchRows,omitempty"`
-	Session             string              `json:"Session,omitempty"`
-	SqlQuery            string              `json:"-"`
-	SqlQuery64          string              `json:"-"`
-	SqlQueryArgs        []any               `json:"-"`
-	Tree                []db.TypeModuleTree `json:"Tree,omitempty"`
-	Values              map[string]string   `json:"Values,omitempty"`
-	GoogleSsoId         string              `json:"GoogleSsoId,omitempty"`
-	SubModules          []db.TypeLink       `json:"SubModules,omitempty"`
-	SubModulePath       []SubModulePathItem `json:"SubModulePath,omitempty"`
-	SubModulePathString string              `json:"SubModulePathString,omitempty"`
+	Action              string                           `json:"Action,omitempty"`
+	ActionType          string                           `json:"ActionType,omitempty"`
+	Alert               []string                         `json:"Alert,omitempty"`
+	AuditId             int64                            `json:"AuditId,omitempty"`
+	AuditVersion        bool                             `json:"AuditVersion,omitempty"`
+	Commands            []db.TypeCommand                 `json:"Commands,omitempty"`
+	Conflicts           map[string]string                `json:"Conflicts,omitempty"`
+	Confirm             bool                             `json:"Confirm,omitempty"`
+	Confirmations       []string                         `json:"Confirmations,omitempty"`
+	DefaultSearchLimit  int64                            `json:"DefaultSearchLimit,omitempty"`
+	DefaultSearchOrder  string                           `json:"DefaultSearchOrder,omitempty"`
+	FieldErrors         map[string]string                `json:"FieldErrors,omitempty"`
+	FieldFile           string                           `json:"FieldFile,omitempty"`
+	FieldNameList       []string                         `json:"FieldNameList,omitempty"`
+	Filter              *db.TypeFilter                   `json:"Filter,omitempty"`
+	Fields              []db.TypeField                   `json:"Fields,omitempty"`
+	File                db.TypeFile                      `json:"-"`
+	FileThumb           bool                             `json:"FileThumb,omitempty"`
+	History             []db.TypeAudit                   `json:"History,omitempty"`
+	Id                  int64                            `json:"Id,omitempty"`
+	IdList              []int64                          `json:"IdList,omitempty"`
+	Info                []string                         `json:"Info,omitempty"`
+	Language            string                           `json:"Language,omitempty"`
+	Link                db.TypeLink                      `json:"Link"`
+	Linking             bool                             `json:"Linking,omitempty"`
+	Links               []db.TypeLink                    `json:"Links,omitempty"`
+	ModuleId            int64                            `json:"ModuleId,omitempty"`
+	ModuleLabel         string                           `json:"ModuleLabel,omitempty"`
+	ModuleName          string                           `json:"ModuleName,omitempty"`
+	Owner               int64                            `json:"-"`
+	Path                []db.TypeModulePath              `json:"Path,omitempty"`
+	SearchCols          []string                         `json:"SearchCols,omitempty"`
+	SearchCount         int64                            `json:"SearchCount,omitempty"`
+	SearchId            int64                            `json:"SearchId,omitempty"`
+	SearchLabels        map[string]string                `json:"SearchLabels,omitempty"`
+	SearchLast          int64                            `json:"SearchLast,omitempty"`
+	SearchLimit         int64                            `json:"SearchLimit,omitempty"`
+	SearchLink          bool                             `json:"SearchLink,omitempty"`
+	SearchLinkClean     bool                             `json:"SearchLinkClean,omitempty"`
+	SearchLinks         []string                         `json:"SearchLinks,omitempty"`
+	SearchName          string                           `json:"SearchName,omitempty"`
+	SearchOffset        int64                            `json:"SearchOffset,omitempty"`
+	SearchOrder         map[string]string                `json:"SearchOrder,omitempty"`
+	SearchRows          db.TypeRows                      `json:"SearchRows,omitempty"`
+	SearchResult        db.TypeResult                    `json:"-"`
+	SearchTotals        map[string]string                `json:"SearchTotals,omitempty"`
+	Searches            []db.TypeSavedSearch             `json:"Searches,omitempty"`
+	Session             string                           `json:"Session,omitempty"`
+	SqlQuery            string                           `json:"-"`
+	SqlQuery64          string                           `json:"-"`
+	SqlQueryArgs        []any                            `json:"-"`
+	Uploads             map[string]*multipart.FileHeader `json:"-"`
+	Trash               bool                             `json:"Trash,omitempty"`
+	Tree                []db.TypeModuleTree              `json:"Tree,omitempty"`
+	Values              map[string]string                `json:"Values,omitempty"`
+	Version             string                           `json:"Version,omitempty"`
+	Record              db.TypeRecord                    `json:"-"`
+	TypedValues         bool                             `json:"TypedValues,omitempty"`
+	GoogleSsoId         string                           `json:"GoogleSsoId,omitempty"`
+	SubModules          []db.TypeLink                    `json:"SubModules,omitempty"`
+	SubModulePath       []SubModulePathItem              `json:"SubModulePath,omitempty"`
+	SubModulePathString string                           `json:"SubModulePathString,omitempty"`
 	RemoteIP            string
 }
 
+// MarshalJSON emits SearchRows and Values with real numbers, booleans and
+// nulls when the client sets TypedValues, otherwise every value is a string
+// except json fields, which are always embedded as they are.
+func (eja Api) MarshalJSON() ([]byte, error) {
+	type plain Api
+	if !eja.TypedValues {
+		documents := eja.jsonFields()
+		if len(documents) == 0 {
+			return json.Marshal(plain(eja))
+		}
+		var rows []map[string]any
+		for _, row := range eja.SearchRows {
+			rows = append(rows, jsonEmbed(row, documents))
+		}
+		return json.Marshal(struct {
+			plain
+			SearchRows []map[string]any `json:"SearchRows,omitempty"`
+			Values     map[string]any   `json:"Values,omitempty"`
+		}{plain(eja), rows, jsonEmbed(eja.Values, documents)})
+	}
+
+	values := make(map[string]any, len(eja.Values))
+	for key, value := range eja.Values {
+		values[key] = value
+	}
+	for key, value := range eja.Record {
+		values[key] = value
+	}
+
+	return json.Marshal(struct {
+		plain
+		SearchRows []db.TypeRecord `json:"SearchRows,omitempty"`
+		Values     map[string]any  `json:"Values,omitempty"`
+	}{plain(eja), eja.SearchResult.Records(), values})
+}
+
 type SubModulePathItem struct {
 	LinkingModuleId int64  `json:"LinkingModuleId"`
 	ModuleId        int64  `json:"ModuleId"`
 	FieldId         int64  `json:"FieldId"`
 	FieldName       string `json:"FieldName"`
 }
+
+// jsonFields returns the names of the json fields of the current view.
+func (eja Api) jsonFields() map[string]bool {
+	names := map[string]bool{}
+	for _, field := range eja.Fields {
+		if field.Type == "json" {
+			names[field.Name] = true
+		}
+	}
+	for _, column := range eja.SearchResult.Columns {
+		if column.Type == "json" {
+			names[column.Name] = true
+		}
+	}
+	return names
+}
+
+// jsonEmbed copies values replacing the valid documents of the json fields
+// with their raw JSON.
+func jsonEmbed(values map[string]string, documents map[string]bool) map[string]any {
+	if values == nil {
+		return nil
+	}
+	embedded := make(map[string]any, len(values))
+	for key, value := range values {
+		embedded[key] = value
+		if documents[key] && json.Valid([]byte(value)) {
+			embedded[key] = json.RawMessage(value)
+		}
+	}
+	return embedded
+}
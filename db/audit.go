@@ -0,0 +1,150 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// TypeAudit is a single change recorded in ejaAudit, Field is empty for the
+// actions that touch the whole record.
+type TypeAudit struct {
+	Id       int64
+	Log      string
+	UserId   int64
+	User     string
+	Action   string
+	ModuleId int64
+	RecordId int64
+	Field    string
+	OldValue string
+	NewValue string
+	RemoteIp string
+}
+
+// auditSkip lists the tables whose changes are not recorded.
+var auditSkip = map[string]bool{
+	"ejaAudit":    true,
+	"ejaSessions": true,
+}
+
+// audit records a change done by userId, it is a no-op when the ejaAudit
+// table is missing so databases created by older versions keep working.
+func (session *TypeSession) audit(userId int64, action string, moduleId int64, recordId int64, fieldName string, oldValue string, newValue string) error {
+	if session.noAudit || auditSkip[session.ModuleGetNameById(moduleId)] {
+		return nil
+	}
+	if check, err := session.TableExists("ejaAudit"); err != nil || !check {
+		return err
+	}
+
+	if fieldName != "" && session.FieldTypeGet(moduleId, fieldName) == "password" {
+		oldValue, newValue = "", ""
+	}
+
+	_, err := session.Run(`
+		INSERT INTO ejaAudit
+			(ejaId, ejaOwner, ejaLog, action, ejaModuleId, recordId, field, oldValue, newValue, remoteIp)
+		VALUES
+			(NULL,?,?,?,?,?,?,?,?,?)
+		`, userId, session.Now(), action, moduleId, recordId, fieldName, oldValue, newValue, session.RemoteIp)
+	return err
+}
+
+// AuditHistory returns the changes of a record, the most recent first.
+func (session *TypeSession) AuditHistory(ownerId int64, moduleId int64, recordId int64) (history []TypeAudit, err error) {
+	if check, err := session.TableExists("ejaAudit"); err != nil || !check {
+		return nil, err
+	}
+	if row, err := session.Get(ownerId, moduleId, recordId); err != nil || len(row) == 0 {
+		return nil, err
+	}
+
+	rows, err := session.Rows(`
+		SELECT a.*, (SELECT u.username FROM ejaUsers AS u WHERE u.ejaId=a.ejaOwner) AS username
+		FROM ejaAudit AS a
+		WHERE a.ejaModuleId=? AND a.recordId=?
+		ORDER BY a.ejaId DESC
+		`, moduleId, recordId)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		history = append(history, TypeAudit{
+			Id:       session.Number(row["ejaId"]),
+			Log:      row["ejaLog"],
+			UserId:   session.Number(row["ejaOwner"]),
+			User:     row["username"],
+			Action:   row["action"],
+			ModuleId: session.Number(row["ejaModuleId"]),
+			RecordId: session.Number(row["recordId"]),
+			Field:    row["field"],
+			OldValue: row["oldValue"],
+			NewValue: row["newValue"],
+			RemoteIp: row["remoteIp"],
+		})
+	}
+	return
+}
+
+// AuditRestore puts back the old value of the audit entry auditId, or with
+// version the whole record as it was before that change: every field changed
+// since then gets the value it had at that time. The entry must belong to
+// recordId of moduleId.
+func (session *TypeSession) AuditRestore(ownerId int64, moduleId int64, recordId int64, auditId int64, version bool) error {
+	return session.WithTx(func(session *TypeSession) error {
+		entry, err := session.Row("SELECT * FROM ejaAudit WHERE ejaId=?", auditId)
+		if err != nil {
+			return err
+		}
+		if len(entry) == 0 || session.Number(entry["ejaModuleId"]) != moduleId || session.Number(entry["recordId"]) != recordId {
+			return errors.New("audit entry not found")
+		}
+		if row, err := session.Get(ownerId, moduleId, recordId); err != nil || len(row) == 0 {
+			if err == nil {
+				err = errors.New("record not found")
+			}
+			return err
+		}
+
+		query, args := "SELECT * FROM ejaAudit WHERE ejaId=? AND action='put'", []any{auditId}
+		if version {
+			query = "SELECT * FROM ejaAudit WHERE ejaModuleId=? AND recordId=? AND ejaId>=? AND action='put' ORDER BY ejaId ASC"
+			args = []any{moduleId, recordId, auditId}
+		}
+		rows, err := session.Rows(query, args...)
+		if err != nil {
+			return err
+		}
+
+		restored := map[string]bool{}
+		for _, row := range rows {
+			if restored[row["field"]] || session.FieldTypeGet(moduleId, row["field"]) == "password" {
+				continue
+			}
+			restored[row["field"]] = true
+			var value any
+			if row["oldValue"] != "" {
+				value = row["oldValue"]
+			}
+			if err := session.Put(ownerId, moduleId, recordId, row["field"], value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// auditRow serializes a whole record for the actions that remove it.
+func auditRow(row TypeRow) string {
+	if len(row) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(row)
+	if err != nil {
+		return fmt.Sprint(row)
+	}
+	return string(data)
+}
@@ -34,7 +34,7 @@ func (session *TypeSession) Commands(userId int64, moduleId int64, actionType st
     SELECT *
     FROM ejaCommands
     WHERE ejaId IN (
-        SELECT ejaCommandId
+        SELECT %s
         FROM ejaPermissions
         WHERE ejaModuleId=? AND ejaId IN (
             SELECT srcFieldId
@@ -45,7 +45,7 @@ func (session *TypeSession) Commands(userId int64, moduleId int64, actionType st
             )
         )
     ) %s`,
-		session.UserGroupCsv(userId), actionTypeSql)
+		session.integerSql("ejaCommandId"), session.UserGroupCsv(userId), actionTypeSql)
 
 	rows, err := session.Rows(
 		query,
@@ -0,0 +1,71 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var contactPhoneRegex = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// ContactNormalize returns the canonical form of an email, url or phone
+// value: lower case email domains, http(s) urls with a lower case host, https
+// being added when the scheme is missing, and E.164 phone numbers. ok is false
+// when the value is not valid.
+func ContactNormalize(fieldType string, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	switch fieldType {
+	case "email":
+		address, err := mail.ParseAddress(value)
+		if err != nil || address.Address != value {
+			return "", false
+		}
+		at := strings.LastIndex(value, "@")
+		domain := strings.ToLower(value[at+1:])
+		if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+			return "", false
+		}
+		return value[:at+1] + domain, true
+	case "url":
+		if !strings.Contains(value, "://") {
+			value = "https://" + value
+		}
+		link, err := url.Parse(value)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Hostname() == "" || link.User != nil || strings.ContainsAny(value, " \t\r\n") {
+			return "", false
+		}
+		link.Scheme, link.Host = strings.ToLower(link.Scheme), strings.ToLower(link.Host)
+		return link.String(), true
+	case "phone":
+		phone := strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "").Replace(value)
+		if strings.HasPrefix(phone, "00") {
+			phone = "+" + phone[2:]
+		}
+		if !contactPhoneRegex.MatchString(phone) {
+			return "", false
+		}
+		return phone, true
+	}
+	return value, true
+}
+
+// ContactLink returns the mailto, tel or web address of a valid contact
+// value, or an empty string.
+func ContactLink(fieldType string, value string) string {
+	normalized, ok := ContactNormalize(fieldType, value)
+	if !ok || normalized != value {
+		return ""
+	}
+	switch fieldType {
+	case "email":
+		return "mailto:" + value
+	case "phone":
+		return "tel:" + value
+	case "url":
+		return value
+	}
+	return ""
+}
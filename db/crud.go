@@ -23,6 +23,9 @@ func (session *TypeSession) New(ownerId int64, moduleId int64) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	if err := session.audit(ownerId, "new", moduleId, run.LastId, "", "", ""); err != nil {
+		return 0, err
+	}
 	return run.LastId, nil
 }
 
@@ -60,42 +63,128 @@ func (session *TypeSession) Put(ownerId int64, moduleId int64, ejaId int64, fiel
 		return errors.New("field not found")
 	}
 
-	query := fmt.Sprintf("UPDATE %s SET %s=? WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, fieldName, session.OwnersCsv(ownerId, moduleId))
-	_, err = session.Run(query, fieldValue, ejaId)
+	owners := session.OwnersCsv(ownerId, moduleId)
+	oldValue, err := session.Value(fmt.Sprintf("SELECT %s FROM %s WHERE ejaId=? AND ejaOwner IN (%s)", fieldName, moduleName, owners), ejaId)
 	if err != nil {
 		return err
 	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s=? WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, fieldName, owners)
+	run, err := session.Run(query, fieldValue, ejaId)
+	if err != nil {
+		return err
+	}
+
+	newValue := ""
+	if fieldValue != nil {
+		newValue = session.String(fieldValue)
+	}
+	if run.Changes > 0 && newValue != oldValue {
+		return session.audit(ownerId, "put", moduleId, ejaId, fieldName, oldValue, newValue)
+	}
 	return nil
 }
 
+// Del removes the record and its links, on modules with the trash enabled the
+// record is only moved to the trash. Removing it applies the onDelete rules of
+// the sub-modules pointing to it, failing with TypeDeleteRestricted when some
+// of their records are left.
 func (session *TypeSession) Del(ownerId int64, moduleId, ejaId int64) error {
-	owners := session.Owners(ownerId, moduleId)
-	csv := session.NumbersToCsv(owners)
-	moduleName := session.ModuleGetNameById(moduleId)
+	if session.ModuleTrash(moduleId) {
+		return session.Trash(ownerId, moduleId, ejaId)
+	}
+	return session.remove(ownerId, moduleId, ejaId)
+}
 
-	if moduleName == "ejaModules" {
-		ejaModulesOwnersCsv := session.OwnersCsv(ownerId, moduleId)
-		tableName, err := session.Value("SELECT name FROM ejaModules WHERE ejaId=? AND ejaOwner IN ("+ejaModulesOwnersCsv+")", ejaId)
-		if err == nil && tableName != "" {
-			session.TableDel(tableName)
-			session.Run("DELETE FROM ejaFields WHERE ejaModuleId=?", ejaId)
-			session.Run("DELETE FROM ejaPermissions WHERE ejaModuleId=?", ejaId)
-			session.Run("DELETE FROM ejaTranslations WHERE ejaModuleId=?", ejaId)
-			session.Run("DELETE FROM ejaModuleLinks WHERE dstModuleId=?", ejaId)
+func (session *TypeSession) remove(ownerId int64, moduleId, ejaId int64) error {
+	return session.WithTx(func(session *TypeSession) error {
+		owners := session.Owners(ownerId, moduleId)
+		csv := session.NumbersToCsv(owners)
+		moduleName := session.ModuleGetNameById(moduleId)
+
+		if moduleName == "ejaModules" {
+			ejaModulesOwnersCsv := session.OwnersCsv(ownerId, moduleId)
+			tableName, err := session.Value("SELECT name FROM ejaModules WHERE ejaId=? AND ejaOwner IN ("+ejaModulesOwnersCsv+")", ejaId)
+			if err != nil {
+				return err
+			}
+			if tableName != "" {
+				exists, err := session.TableExists(tableName)
+				if err != nil {
+					return err
+				}
+				if exists {
+					if err := session.TableDel(tableName); err != nil {
+						return err
+					}
+				}
+				cleanup := []string{
+					"DELETE FROM ejaFields WHERE ejaModuleId=?",
+					"DELETE FROM ejaPermissions WHERE ejaModuleId=?",
+					"DELETE FROM ejaTranslations WHERE ejaModuleId=?",
+					"DELETE FROM ejaModuleLinks WHERE dstModuleId=?",
+				}
+				check, err := session.TableExists("ejaSearches")
+				if err != nil {
+					return err
+				}
+				if check {
+					cleanup = append(cleanup, "DELETE FROM ejaSearches WHERE ejaModuleId=?")
+				}
+				for _, query := range cleanup {
+					if _, err := session.Run(query, ejaId); err != nil {
+						return err
+					}
+				}
+			}
 		}
-	}
 
-	// Delete the entry from the module table
-	query := fmt.Sprintf("DELETE FROM %s WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, csv)
-	if _, err := session.Run(query, ejaId); err != nil {
-		return err
-	}
+		var schemaDiff TypeSchemaDiff
+		if moduleName == "ejaFields" {
+			diff, err := session.SchemaDiff(ejaId, 0, "", "", "")
+			if err != nil {
+				return err
+			}
+			schemaDiff = diff
+		}
 
-	// Delete related entries from 'ejaLinks' table
-	query = fmt.Sprintf("DELETE FROM ejaLinks WHERE (dstModuleId=? AND dstFieldId=?) OR (srcModuleId=? AND srcFieldId=?) AND ejaOwner IN (%s)", csv)
-	if _, err := session.Run(query, moduleId, ejaId, moduleId, ejaId); err != nil {
-		return err
-	}
+		dependents, err := session.integrityCheck(moduleId, ejaId)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		// Delete the entry from the module table
+		row, err := session.Row(fmt.Sprintf("SELECT * FROM %s WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, csv), ejaId)
+		if err != nil {
+			return err
+		}
+		query := fmt.Sprintf("DELETE FROM %s WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, csv)
+		run, err := session.Run(query, ejaId)
+		if err != nil {
+			return err
+		}
+		if run.Changes > 0 {
+			if err := session.audit(ownerId, "del", moduleId, ejaId, "", auditRow(row), ""); err != nil {
+				return err
+			}
+			if err := session.integrityApply(ownerId, dependents, ejaId); err != nil {
+				return err
+			}
+		}
+
+		// Drop the column of a removed field
+		if run.Changes > 0 && !schemaDiff.Empty() {
+			if err := session.SchemaApply(schemaDiff); err != nil {
+				return err
+			}
+		}
+
+		// Delete related entries from 'ejaLinks' table
+		query = fmt.Sprintf("DELETE FROM ejaLinks WHERE (dstModuleId=? AND dstFieldId=?) OR (srcModuleId=? AND srcFieldId=?) AND ejaOwner IN (%s)", csv)
+		if _, err := session.Run(query, moduleId, ejaId, moduleId, ejaId); err != nil {
+			return err
+		}
+
+		return nil
+	})
 }
@@ -0,0 +1,286 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TypeEngine is implemented by every database backend, new engines can be
+// added from outside the package with EngineRegister.
+type TypeEngine interface {
+	Open(database string, username string, password string, host string, port int) (*sql.DB, error)
+	Run(session *TypeSession, query string, args ...any) (TypeRun, error)
+	Value(session *TypeSession, query string, args ...any) (string, error)
+	Row(session *TypeSession, query string, args ...any) (TypeRow, error)
+	Rows(session *TypeSession, query string, args ...any) (TypeRows, error)
+	Cols(session *TypeSession, query string, args ...any) ([]string, error)
+	Query(session *TypeSession, query string, args ...any) (TypeResult, error)
+	TableNameIsValid(name string) error
+	FieldNameIsValid(name string) error
+	TableExists(session *TypeSession, name string) (bool, error)
+	FieldExists(session *TypeSession, tableName string, fieldName string) (bool, error)
+	TableAdd(tableName string, temporary bool) []string
+	FieldAdd(tableName string, fieldName string, sqlType string) string
+	FieldType(fieldType string) string
+	FieldDel(session *TypeSession, tableName string, fieldName string) error
+	FieldRename(session *TypeSession, tableName string, fieldName string, newName string) error
+	FieldRetype(session *TypeSession, tableName string, fieldName string, sqlType string) error
+	IndexAdd(session *TypeSession, tableName string, indexName string, fieldNames []string, unique bool) error
+	IndexDel(session *TypeSession, tableName string, indexName string) error
+	FtsAdd(session *TypeSession, tableName string, fieldName string) error
+	FtsDel(session *TypeSession, tableName string, fieldName string) error
+	SearchFts(tableName string, fieldName string) string
+	SearchLike(fieldName string) string
+	SearchMultiple(fieldName string) string
+	Formula(function string, args []string) string
+	GeoPoint(fieldName string) (string, string)
+	JsonPath(fieldName string, path string, numeric bool) string
+	Limit(limit int64, offset int64) string
+	WindowCount(session *TypeSession) bool
+	Integer(expr string) string
+	IdSync(session *TypeSession, tableName string) error
+	Lock(session *TypeSession, tableName string, ejaId int64) error
+}
+
+type TypeEngines map[string]TypeEngine
+
+var Engines = TypeEngines{
+	"sqlite":   &sqliteEngine{},
+	"mysql":    &mysqlEngine{},
+	"postgres": &postgresEngine{},
+}
+
+func EngineRegister(name string, engine TypeEngine) {
+	Engines[name] = engine
+}
+
+func (session *TypeSession) engine() (TypeEngine, error) {
+	if engine, ok := Engines[session.Engine]; ok {
+		return engine, nil
+	}
+	return nil, errors.New("engine not found")
+}
+
+// TypeEngineSql implements the database/sql based part of TypeEngine and can
+// be embedded by engines that do not need to rewrite the queries.
+type TypeEngineSql struct{}
+
+func (engine *TypeEngineSql) Run(session *TypeSession, query string, args ...any) (TypeRun, error) {
+	result, err := session.Querier().ExecContext(session.Context(), query, args...)
+	if err != nil {
+		return TypeRun{}, err
+	}
+	lastId, _ := result.LastInsertId()
+	changes, _ := result.RowsAffected()
+	return TypeRun{Changes: changes, LastId: lastId}, nil
+}
+
+func (engine *TypeEngineSql) Value(session *TypeSession, query string, args ...any) (string, error) {
+	var nullResult sql.NullString
+	err := session.Querier().QueryRowContext(session.Context(), query, args...).Scan(&nullResult)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+	if nullResult.Valid {
+		return nullResult.String, nil
+	}
+	return "", nil
+}
+
+func (engine *TypeEngineSql) Row(session *TypeSession, query string, args ...any) (TypeRow, error) {
+	rows, err := session.Querier().QueryContext(session.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result, err := engineScan(rows, 1)
+	if err != nil || len(result) == 0 {
+		return nil, err
+	}
+	return result[0], nil
+}
+
+func (engine *TypeEngineSql) Rows(session *TypeSession, query string, args ...any) (TypeRows, error) {
+	rows, err := session.Querier().QueryContext(session.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return engineScan(rows, 0)
+}
+
+func (engine *TypeEngineSql) Cols(session *TypeSession, query string, args ...any) ([]string, error) {
+	rows, err := session.Querier().QueryContext(session.Context(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+func (engine *TypeEngineSql) Query(session *TypeSession, query string, args ...any) (TypeResult, error) {
+	rows, err := session.Querier().QueryContext(session.Context(), query, args...)
+	if err != nil {
+		return TypeResult{}, err
+	}
+	defer rows.Close()
+	return engineResult(rows, 0)
+}
+
+func (engine *TypeEngineSql) FieldAdd(tableName string, fieldName string, sqlType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s %s", tableName, fieldName, sqlType)
+}
+
+func (engine *TypeEngineSql) FieldType(fieldType string) string {
+	return FieldType(fieldType)
+}
+
+func (engine *TypeEngineSql) FieldDel(session *TypeSession, tableName string, fieldName string) error {
+	_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, fieldName))
+	return err
+}
+
+func (engine *TypeEngineSql) FieldRename(session *TypeSession, tableName string, fieldName string, newName string) error {
+	_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", tableName, fieldName, newName))
+	return err
+}
+
+func (engine *TypeEngineSql) IndexAdd(session *TypeSession, tableName string, indexName string, fieldNames []string, unique bool) error {
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("CREATE %s IF NOT EXISTS %s ON %s (%s)", kind, indexName, tableName, strings.Join(fieldNames, ", ")))
+	return err
+}
+
+func (engine *TypeEngineSql) IndexDel(session *TypeSession, tableName string, indexName string) error {
+	_, err := session.Querier().ExecContext(session.Context(), "DROP INDEX IF EXISTS "+indexName)
+	return err
+}
+
+func (engine *TypeEngineSql) SearchLike(fieldName string) string {
+	return fmt.Sprintf(" AND %s LIKE ? ", fieldName)
+}
+
+func (engine *TypeEngineSql) SearchMultiple(fieldName string) string {
+	return fmt.Sprintf(` AND %s LIKE '%%"' || ? || '"%%' `, fieldName)
+}
+
+// Formula returns the SQL of a formula function call or an empty string when
+// the engine does not support it, days and years depend on the engine.
+func (engine *TypeEngineSql) Formula(function string, args []string) string {
+	switch function {
+	case "abs", "coalesce", "lower", "round", "upper":
+		return fmt.Sprintf("%s(%s)", strings.ToUpper(function), strings.Join(args, ", "))
+	case "concat":
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = fmt.Sprintf("COALESCE(CAST(%s AS TEXT), '')", arg)
+		}
+		return "(" + strings.Join(parts, " || ") + ")"
+	}
+	return ""
+}
+
+// GeoPoint returns the SQL expressions reading latitude and longitude from a
+// geo field, which is stored as "lat,lon".
+func (engine *TypeEngineSql) GeoPoint(fieldName string) (string, string) {
+	return fmt.Sprintf("CAST(SUBSTR(%s, 1, INSTR(%s, ',') - 1) AS DECIMAL(11,8))", fieldName, fieldName),
+		fmt.Sprintf("CAST(SUBSTR(%s, INSTR(%s, ',') + 1) AS DECIMAL(11,8))", fieldName, fieldName)
+}
+
+// JsonPath returns the SQL reading the value at path of a json field, as a
+// number when numeric is set, path has already been validated.
+func (engine *TypeEngineSql) JsonPath(fieldName string, path string, numeric bool) string {
+	cast := "TEXT"
+	if numeric {
+		cast = "REAL"
+	}
+	return fmt.Sprintf("CASE WHEN json_valid(%s) THEN CAST(json_extract(%s, '%s') AS %s) END", fieldName, fieldName, path, cast)
+}
+
+func (engine *TypeEngineSql) Limit(limit int64, offset int64) string {
+	return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+}
+
+// WindowCount tells whether COUNT(*) OVER() is available, engines that support
+// window functions override it.
+func (engine *TypeEngineSql) WindowCount(session *TypeSession) bool {
+	return false
+}
+
+// Integer returns expr compared as an integer, engines that compare text and
+// numbers loosely keep it as it is.
+func (engine *TypeEngineSql) Integer(expr string) string {
+	return expr
+}
+
+// IdSync aligns the ejaId generator of tableName after explicit ids have been
+// inserted, auto increment columns already follow them.
+func (engine *TypeEngineSql) IdSync(session *TypeSession, tableName string) error {
+	return nil
+}
+
+// Lock holds the record ejaId of tableName until the current transaction
+// ends, so that it cannot change between a check and the following write.
+func (engine *TypeEngineSql) Lock(session *TypeSession, tableName string, ejaId int64) error {
+	_, err := session.Value(fmt.Sprintf("SELECT ejaId FROM %s WHERE ejaId=? FOR UPDATE", tableName), ejaId)
+	return err
+}
+
+// integerSql returns expr compared as an integer on the current engine, for
+// the text columns holding record ids.
+func (session *TypeSession) integerSql(expr string) string {
+	if engine, err := session.engine(); err == nil {
+		return engine.Integer(expr)
+	}
+	return expr
+}
+
+// idSync aligns the ejaId generator of tableName with the ids inserted
+// explicitly.
+func (session *TypeSession) idSync(tableName string) error {
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
+	return engine.IdSync(session, tableName)
+}
+
+// lock holds the record ejaId of tableName until the current transaction ends.
+func (session *TypeSession) lock(tableName string, ejaId int64) error {
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	return engine.Lock(session, tableName, ejaId)
+}
+
+func engineTemporary(temporary bool) string {
+	if temporary {
+		return "TEMPORARY"
+	}
+	return ""
+}
+
+// engineScan reads up to max rows (all of them when max is 0), NULL values become empty strings.
+func engineScan(rows *sql.Rows, max int) (TypeRows, error) {
+	result, err := engineResult(rows, max)
+	if err != nil {
+		return nil, err
+	}
+	return result.Maps(), nil
+}
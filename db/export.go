@@ -40,12 +40,12 @@ func (session *TypeSession) GroupExport(groupId int64) (group TypeGroup, err err
 
 	group.Permissions = make(map[string][]string)
 
-	rows, err = session.Rows(`SELECT
-		(SELECT module.name FROM ejaModules AS module WHERE ejaId=(SELECT lm.ejaModuleId FROM ejaPermissions AS lm WHERE lm.ejaId=srcFieldId)) AS moduleName,
-		(SELECT command.name FROM ejaCommands AS command WHERE ejaId=(SELECT lf.ejaCommandId FROM ejaPermissions AS lf WHERE lf.ejaId=srcFieldId)) AS permissionName
+	rows, err = session.Rows(fmt.Sprintf(`SELECT
+		(SELECT module.name FROM ejaModules AS module WHERE ejaId=(SELECT %s FROM ejaPermissions AS lm WHERE lm.ejaId=srcFieldId)) AS moduleName,
+		(SELECT command.name FROM ejaCommands AS command WHERE ejaId=(SELECT %s FROM ejaPermissions AS lf WHERE lf.ejaId=srcFieldId)) AS permissionName
 		FROM ejaLinks
 		WHERE srcModuleId=? AND dstModuleId=? AND dstFieldId=? ORDER BY srcModuleId,srcFieldId
-		`, permissionsModuleId, groupsModuleId, groupId)
+		`, session.integerSql("lm.ejaModuleId"), session.integerSql("lf.ejaCommandId")), permissionsModuleId, groupsModuleId, groupId)
 	if err != nil {
 		return
 	}
@@ -66,7 +66,7 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 	module.Type = "module"
 	moduleName := session.ModuleGetNameById(moduleId)
 	module.Name = moduleName
-	row, err = session.Row("SELECT a.searchLimit, a.sqlCreated, a.power, a.sortList, (SELECT x.name FROM ejaModules AS x WHERE x.ejaId=a.parentId) AS parentName FROM ejaModules AS a WHERE ejaId=?", moduleId)
+	row, err = session.Row(fmt.Sprintf("SELECT a.searchLimit, a.sqlCreated, a.power, a.sortList, (SELECT x.name FROM ejaModules AS x WHERE x.ejaId=%s) AS parentName FROM ejaModules AS a WHERE ejaId=?", session.integerSql("a.parentId")), moduleId)
 	if err != nil {
 		return
 	}
@@ -77,6 +77,9 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 		SqlCreated:  session.Number(row["sqlCreated"]),
 		SortList:    row["sortList"],
 	}
+	if session.ModuleTrash(moduleId) {
+		module.Module.Trash = 1
+	}
 
 	rows, err = session.Rows("SELECT * FROM ejaFields WHERE ejaModuleId=?", moduleId)
 	if err != nil {
@@ -94,14 +97,23 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 			SizeEdit:    session.Number(row["sizeEdit"]),
 			Type:        row["type"],
 			Translate:   session.Number(row["translate"]),
+			SqlIndex:    FieldIndex(row["sqlIndex"]),
+			Required:    session.Number(row["required"]),
+			ValueMin:    row["valueMin"],
+			ValueMax:    row["valueMax"],
+			LengthMin:   session.Number(row["lengthMin"]),
+			LengthMax:   session.Number(row["lengthMax"]),
+			Pattern:     row["pattern"],
+			ValueUnique: session.Number(row["valueUnique"]),
+			Aggregate:   row["aggregate"],
 		})
 	}
 
-	rows, err = session.Rows(`
-		SELECT ejaLanguage, word, translation, (SELECT ejaModules.name FROM ejaModules WHERE ejaModules.ejaId=ejaModuleId) AS ejaModuleName 
+	rows, err = session.Rows(fmt.Sprintf(`
+		SELECT ejaLanguage, word, translation, (SELECT ejaModules.name FROM ejaModules WHERE ejaModules.ejaId=%s) AS ejaModuleName 
 		FROM ejaTranslations 
 		WHERE ejaModuleId=? OR word=?
-		`, moduleId, moduleName)
+		`, session.integerSql("ejaTranslations.ejaModuleId")), moduleId, moduleName)
 	if err != nil {
 		return
 	}
@@ -115,17 +127,16 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 	}
 
 	moduleLinksMap := map[string]string{}
-	rows, err = session.Rows(`
+	rows, err = session.Rows(fmt.Sprintf(`
 		SELECT
-			power,
-			srcFieldName,
-			(SELECT a.name FROM ejaModules AS a WHERE a.ejaId=srcModuleId LIMIT 1) AS srcModuleName,
-			(SELECT b.name FROM ejaModules AS b WHERE b.ejaId=dstModuleId LIMIT 1) AS dstModuleName
+			*,
+			(SELECT a.name FROM ejaModules AS a WHERE a.ejaId=%s LIMIT 1) AS srcModuleName,
+			(SELECT b.name FROM ejaModules AS b WHERE b.ejaId=%s LIMIT 1) AS dstModuleName
 		FROM
 			ejaModuleLinks
 		WHERE
 			srcModuleId=?
-		`, moduleId)
+		`, session.integerSql("ejaModuleLinks.srcModuleId"), session.integerSql("ejaModuleLinks.dstModuleId")), moduleId)
 	if err != nil {
 		return
 	}
@@ -135,12 +146,13 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 			SrcField:  row["srcFieldName"],
 			DstModule: row["dstModuleName"],
 			Power:     session.Number(row["power"]),
+			OnDelete:  row["onDelete"],
 		})
 		moduleLinksMap[row["srcFieldName"]] = row["dstModuleName"]
 	}
 
 	module.Command = []string{}
-	rows, err = session.Rows("SELECT name from ejaCommands WHERE ejaId IN (SELECT ejaCommandId FROM ejaPermissions WHERE ejaModuleId=?)", moduleId)
+	rows, err = session.Rows(fmt.Sprintf("SELECT name from ejaCommands WHERE ejaId IN (SELECT %s FROM ejaPermissions WHERE ejaModuleId=?)", session.integerSql("ejaCommandId")), moduleId)
 	if err != nil {
 		return
 	}
@@ -149,6 +161,16 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 	}
 
 	if data {
+		fileFields := map[string]bool{}
+		referenceFields := map[string]TypeReference{}
+		for _, field := range module.Field {
+			if field.Type == "file" || field.Type == "image" {
+				fileFields[field.Name] = true
+			}
+			if reference, ok := ReferenceField(field.Value); ok && field.Type == "reference" && session.referenceValid(reference) == nil {
+				referenceFields[field.Name] = reference
+			}
+		}
 		rows, err = session.Rows("SELECT * FROM " + moduleName)
 		if err != nil {
 			return
@@ -156,6 +178,24 @@ func (session *TypeSession) ModuleExport(moduleId int64, data bool) (module Type
 		for idx, row := range rows {
 			module.Data = append(module.Data, make(map[string]any))
 			for key, val := range row {
+				if file, ok := FileParse(val); ok && fileFields[key] {
+					if module.Files == nil {
+						module.Files = map[string][]byte{}
+					}
+					if module.Files[file.Hash], err = fileRead(file); err != nil {
+						return
+					}
+					if file.Thumb != "" {
+						if module.Files[file.Thumb], err = fileRead(file.ThumbFile()); err != nil {
+							return
+						}
+					}
+				}
+				if reference, ok := referenceFields[key]; ok && val != "" {
+					if label, labelErr := session.Value(fmt.Sprintf("SELECT %s FROM %s WHERE ejaId=? LIMIT 1", reference.Field, reference.Module), val); labelErr == nil {
+						module.Data[idx][key+"."+reference.Module] = label
+					}
+				}
 				if moduleLinksMap[key] != "" {
 					moduleName := moduleLinksMap[key]
 					if lnkVal, lnkErr := session.Value(fmt.Sprintf("SELECT %s FROM %s WHERE ejaId=? LIMIT 1", key, moduleName), val); lnkErr == nil {
@@ -5,6 +5,7 @@ package db
 import (
 	"errors"
 	"fmt"
+	"strconv"
 )
 
 type TypeField struct {
@@ -19,10 +20,12 @@ type TypeField struct {
 	EditIndex   int64
 	EditSize    int64
 	Options     []TypeSelect
+	Url         string
+	Preview     string
 }
 
 func (session *TypeSession) FieldNameList(moduleId int64, actionType string) (fields []string) {
-	rows, err := session.Rows(fmt.Sprintf("SELECT name FROM ejaFields WHERE ejaModuleId=%d AND power%s>0 AND power%s!='' ORDER BY power%s ASC;", moduleId, actionType, actionType, actionType))
+	rows, err := session.Rows(fmt.Sprintf("SELECT name FROM ejaFields WHERE ejaModuleId=? AND power%s+0>0 ORDER BY power%s ASC;", actionType, actionType), moduleId)
 	if err == nil {
 		for _, row := range rows {
 			fields = append(fields, row["name"])
@@ -34,7 +37,7 @@ func (session *TypeSession) FieldNameList(moduleId int64, actionType string) (fi
 func (session *TypeSession) Fields(ownerId int64, moduleId int64, actionType string, values map[string]string) ([]TypeField, error) {
 	var res []TypeField
 
-	rows, err := session.Rows(fmt.Sprintf("SELECT * FROM ejaFields WHERE ejaModuleId=%d AND power%s>0 AND power%s!='' ORDER BY power%s ASC;", moduleId, actionType, actionType, actionType))
+	rows, err := session.Rows(fmt.Sprintf("SELECT * FROM ejaFields WHERE ejaModuleId=? AND power%s+0>0 ORDER BY power%s ASC;", actionType, actionType), moduleId)
 	if err != nil {
 		return res, err
 	}
@@ -57,9 +60,40 @@ func (session *TypeSession) Fields(ownerId int64, moduleId int64, actionType str
 		if rowType == "sqlMatrix" || rowType == "sqlMultiple" {
 			rowOptions = session.SelectSqlToRows(row["value"])
 		}
+		if rowType == "reference" {
+			rowValue = values[rowName]
+			rowOptions = session.ReferenceOptions(ownerId, row["value"])
+		}
 		if rowType == "sqlValue" || rowType == "sqlHidden" {
 			rowValue, _ = session.Value(row["value"])
 		}
+		if rowType == "money" {
+			rowValue = values[rowName]
+			if amount, err := strconv.ParseInt(rowValue, 10, 64); err == nil {
+				rowValue = MoneyField(row["value"]).Format(amount, session.UserLanguage(ownerId))
+			}
+		}
+		if rowType == "formula" {
+			rowValue = ""
+			if actionType == "Edit" && session.Number(values["ejaId"]) > 0 {
+				rowValue, _ = session.formulaValue(moduleId, row["value"], session.Number(values["ejaId"]))
+			}
+		}
+
+		var rowUrl, rowPreview string
+		if actionType == "Edit" && session.Number(values["ejaId"]) > 0 {
+			switch rowType {
+			case "file":
+				if _, ok := FileParse(rowValue); ok {
+					rowUrl = FileUrl(moduleId, session.Number(values["ejaId"]), rowName, false)
+				}
+			case "image":
+				if _, ok := ImageParse(rowValue); ok {
+					rowUrl = FileUrl(moduleId, session.Number(values["ejaId"]), rowName, false)
+					rowPreview = FileUrl(moduleId, session.Number(values["ejaId"]), rowName, true)
+				}
+			}
+		}
 
 		if session.Number(row["translate"]) > 0 {
 			rowValue = session.Translate(rowValue, ownerId)
@@ -75,6 +109,8 @@ func (session *TypeSession) Fields(ownerId int64, moduleId int64, actionType str
 			Label:       session.Translate(rowName, ownerId),
 			Value:       rowValue,
 			Options:     rowOptions,
+			Url:         rowUrl,
+			Preview:     rowPreview,
 			SearchIndex: session.Number(row["powerSearch"]),
 			SearchSize:  session.Number(row["sizeSearch"]),
 			ListIndex:   session.Number(row["powerList"]),
@@ -89,10 +125,15 @@ func (session *TypeSession) Fields(ownerId int64, moduleId int64, actionType str
 }
 
 func (session *TypeSession) FieldAdd(tableName string, fieldName string, fieldType string) error {
-	if fieldType == "label" || fieldType == "sqlValue" {
+	if !fieldHasColumn(fieldType) {
 		return nil
 	}
 
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
+
 	check, err := session.TableExists(tableName)
 	if err != nil {
 		return err
@@ -109,49 +150,37 @@ func (session *TypeSession) FieldAdd(tableName string, fieldName string, fieldTy
 		return errors.New("field already exists")
 	}
 
-	sqlFieldType := FieldType(fieldType)
-	_, err = session.Run(fmt.Sprintf("ALTER TABLE %s ADD %s %s", tableName, fieldName, sqlFieldType))
+	_, err = session.Run(engine.FieldAdd(tableName, fieldName, engine.FieldType(fieldType)))
 	if err != nil {
 		return err
 	}
 
 	if fieldType == "fts" {
-		if session.Engine == "sqlite" {
-			return session.sqliteFtsAdd(tableName, fieldName)
-		}
-		if session.Engine == "mysql" {
-			return session.mysqlFtsAdd(tableName, fieldName)
-		}
+		return engine.FtsAdd(session, tableName, fieldName)
 	}
 
 	return nil
 }
 
 func (session *TypeSession) FieldExists(tableName string, fieldName string) (bool, error) {
-	switch session.Engine {
-	case "sqlite":
-		return session.sqliteFieldExists(tableName, fieldName)
-	case "mysql":
-		return session.mysqlFieldExists(tableName, fieldName)
-	default:
-		return false, errors.New("engine not found")
+	engine, err := session.engine()
+	if err != nil {
+		return false, err
 	}
+	return engine.FieldExists(session, tableName, fieldName)
 }
 
 func (session *TypeSession) FieldNameIsValid(name string) error {
-	switch session.Engine {
-	case "sqlite":
-		return sqliteFieldNameIsValid(name)
-	case "mysql":
-		return mysqlFieldNameIsValid(name)
-	default:
-		return errors.New("engine not found")
+	engine, err := session.engine()
+	if err != nil {
+		return err
 	}
+	return engine.FieldNameIsValid(name)
 }
 
 func FieldType(name string) string {
 	switch name {
-	case "boolean", "integer":
+	case "boolean", "integer", "money", "reference":
 		return "INTEGER"
 	case "decimal":
 		return "DOUBLE"
@@ -170,3 +199,8 @@ func (session *TypeSession) FieldTypeGet(moduleId int64, fieldName string) strin
 	value, _ := session.Value("SELECT type FROM ejaFields WHERE ejaModuleId=? AND name=?", moduleId, fieldName)
 	return value
 }
+
+func (session *TypeSession) fieldValueGet(moduleId int64, fieldName string) string {
+	value, _ := session.Value("SELECT value FROM ejaFields WHERE ejaModuleId=? AND name=?", moduleId, fieldName)
+	return value
+}
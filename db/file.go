@@ -0,0 +1,146 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// FilesPath is the directory where the attachments are stored, each one in a
+// file named after the sha256 of its content so equal uploads are kept once.
+var FilesPath = "files"
+
+var fileHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// TypeFile is the metadata stored in the column of a file field.
+type TypeFile struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Mime string `json:"mime"`
+	Hash string `json:"hash"`
+	// Thumb is the hash of the thumbnail of an image.
+	Thumb string `json:"thumb,omitempty"`
+}
+
+// FileParse reads the metadata stored in a file field, ok is false when the
+// value is empty or not valid.
+func FileParse(value string) (file TypeFile, ok bool) {
+	if value == "" || json.Unmarshal([]byte(value), &file) != nil || !fileHashRegex.MatchString(file.Hash) {
+		return TypeFile{}, false
+	}
+	return file, true
+}
+
+// String returns the metadata as it is stored in the column.
+func (file TypeFile) String() string {
+	data, _ := json.Marshal(file)
+	return string(data)
+}
+
+// Path returns where the content of the file is stored.
+func (file TypeFile) Path() string {
+	return filepath.Join(FilesPath, file.Hash[:2], file.Hash)
+}
+
+// Exists tells whether the content of the file is in the storage.
+func (file TypeFile) Exists() bool {
+	if !fileHashRegex.MatchString(file.Hash) {
+		return false
+	}
+	info, err := os.Stat(file.Path())
+	return err == nil && info.Mode().IsRegular()
+}
+
+// FileStore copies the content of an upload into the storage.
+func FileStore(name string, mime string, content io.Reader) (file TypeFile, err error) {
+	if err = os.MkdirAll(FilesPath, 0o750); err != nil {
+		return
+	}
+	temp, err := os.CreateTemp(FilesPath, "upload-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(temp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(temp, hash), content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+
+	file = TypeFile{Name: filepath.Base(name), Size: size, Mime: mime, Hash: hex.EncodeToString(hash.Sum(nil))}
+	if file.Exists() {
+		return file, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(file.Path()), 0o750); err != nil {
+		return
+	}
+	return file, os.Rename(temp.Name(), file.Path())
+}
+
+// FileGet returns the file stored in fieldName of a record the user can read.
+func (session *TypeSession) FileGet(ownerId int64, moduleId int64, ejaId int64, fieldName string) (TypeFile, error) {
+	if fieldType := session.FieldTypeGet(moduleId, fieldName); fieldType != "file" && fieldType != "image" {
+		return TypeFile{}, errors.New("field not found")
+	}
+	row, err := session.Get(ownerId, moduleId, ejaId)
+	if err != nil {
+		return TypeFile{}, err
+	}
+	file, ok := FileParse(row[fieldName])
+	if !ok || !file.Exists() {
+		return TypeFile{}, errors.New("file not found")
+	}
+	return file, nil
+}
+
+// fileRead returns the content of a stored file checking it still matches its hash.
+func fileRead(file TypeFile) ([]byte, error) {
+	data, err := os.ReadFile(file.Path())
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != file.Hash {
+		return nil, fmt.Errorf("file %s is corrupted", file.Hash)
+	}
+	return data, nil
+}
+
+// fileWrite stores the content of an imported file, which must match hash.
+func fileWrite(hash string, data []byte) error {
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("file %s does not match its content", hash)
+	}
+	file := TypeFile{Hash: hash}
+	if file.Exists() {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file.Path()), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(file.Path(), data, 0o640)
+}
+
+// fileImport stores the attachments carried by an exported module.
+func fileImport(files map[string][]byte) error {
+	for hash, data := range files {
+		if !fileHashRegex.MatchString(hash) {
+			return fmt.Errorf("file %s is not valid", hash)
+		}
+		if err := fileWrite(hash, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
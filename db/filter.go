@@ -0,0 +1,245 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TypeFilter is a search condition tree. A group joins its Filters with Logic,
+// AND when empty or OR, while a leaf applies Op to Field and Value, or to
+// Values for the in, notIn and between operators. Not negates both.
+type TypeFilter struct {
+	Logic   string       `json:"Logic,omitempty"`
+	Not     bool         `json:"Not,omitempty"`
+	Filters []TypeFilter `json:"Filters,omitempty"`
+	Field   string       `json:"Field,omitempty"`
+	Op      string       `json:"Op,omitempty"`
+	Value   string       `json:"Value,omitempty"`
+	Values  []string     `json:"Values,omitempty"`
+}
+
+// FilterDepthMax and FilterValuesMax bound the size of a filter.
+var FilterDepthMax = 8
+var FilterValuesMax = 1000
+
+// filterLikeEscape prefixes the wildcards of the startsWith and contains
+// values, so that they are matched literally on every engine.
+const filterLikeEscape = "!"
+
+var filterLikeEscaper = strings.NewReplacer(filterLikeEscape, filterLikeEscape+filterLikeEscape, "%", filterLikeEscape+"%", "_", filterLikeEscape+"_")
+
+type typeFilterCompiler struct {
+	session  *TypeSession
+	engine   TypeEngine
+	ownerId  int64
+	moduleId int64
+	fields   map[string]TypeRow
+	args     []any
+	count    int
+}
+
+// Empty reports whether the filter has no condition at all.
+func (filter TypeFilter) Empty() bool {
+	if filter.Field != "" || filter.Op != "" {
+		return false
+	}
+	for _, child := range filter.Filters {
+		if !child.Empty() {
+			return false
+		}
+	}
+	return true
+}
+
+// SearchFilter compiles filter into a parameterized condition on the fields
+// of tableName, to be appended to the query returned by SearchQuery. Field
+// names are checked against the module definition and FieldNameIsValid.
+func (session *TypeSession) SearchFilter(ownerId int64, tableName string, filter TypeFilter) (string, []any, error) {
+	if filter.Empty() {
+		return "", nil, nil
+	}
+	engine, err := session.engine()
+	if err != nil {
+		return "", nil, err
+	}
+	moduleId := session.ModuleGetIdByName(tableName)
+	rows, err := session.Rows("SELECT name, type, value FROM ejaFields WHERE ejaModuleId=?", moduleId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	compiler := typeFilterCompiler{
+		session:  session,
+		engine:   engine,
+		ownerId:  ownerId,
+		moduleId: moduleId,
+		fields:   map[string]TypeRow{"ejaId": {"type": "integer"}, "ejaLog": {"type": "datetime"}},
+	}
+	for _, row := range rows {
+		compiler.fields[row["name"]] = row
+	}
+	condition, err := compiler.compile(filter, 0)
+	if err != nil || condition == "" {
+		return "", nil, err
+	}
+	return " AND " + condition + " ", compiler.args, nil
+}
+
+func (compiler *typeFilterCompiler) compile(filter TypeFilter, depth int) (condition string, err error) {
+	if depth > FilterDepthMax {
+		return "", errors.New("filter: too deep")
+	}
+	if filter.Field != "" || filter.Op != "" {
+		condition, err = compiler.leaf(filter)
+	} else {
+		condition, err = compiler.group(filter, depth)
+	}
+	if err != nil || condition == "" {
+		return
+	}
+	if filter.Not {
+		condition = "NOT " + condition
+	}
+	return
+}
+
+func (compiler *typeFilterCompiler) group(filter TypeFilter, depth int) (string, error) {
+	logic := strings.ToUpper(filter.Logic)
+	switch logic {
+	case "":
+		logic = "AND"
+	case "AND", "OR":
+	default:
+		return "", fmt.Errorf("filter: unknown logic %s", filter.Logic)
+	}
+
+	var conditions []string
+	for _, child := range filter.Filters {
+		condition, err := compiler.compile(child, depth+1)
+		if err != nil {
+			return "", err
+		}
+		if condition != "" {
+			conditions = append(conditions, condition)
+		}
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(conditions, " "+logic+" ") + ")", nil
+}
+
+func (compiler *typeFilterCompiler) leaf(filter TypeFilter) (string, error) {
+	session := compiler.session
+	field, ok := compiler.fields[filter.Field]
+	if !ok || session.FieldNameIsValid(filter.Field) != nil {
+		return "", fmt.Errorf("filter: unknown field %s", filter.Field)
+	}
+
+	fieldType := field["type"]
+	column := filter.Field
+	if fieldType == "formula" {
+		formula, err := session.FormulaSql(compiler.moduleId, field["value"])
+		if err != nil {
+			return "", fmt.Errorf("filter: %s: %w", filter.Field, err)
+		}
+		column = "(" + formula + ")"
+	} else if !fieldHasColumn(fieldType) {
+		return "", fmt.Errorf("filter: %s cannot be searched", filter.Field)
+	}
+
+	values := filter.Values
+	switch filter.Op {
+	case "in", "notIn":
+		if len(values) == 0 {
+			return "", fmt.Errorf("filter: %s %s needs values", filter.Field, filter.Op)
+		}
+	case "between":
+		if len(values) != 2 {
+			return "", fmt.Errorf("filter: %s between needs two values", filter.Field)
+		}
+	case "isNull":
+		values = nil
+	default:
+		values = []string{filter.Value}
+	}
+	compiler.count += len(values)
+	if compiler.count > FilterValuesMax {
+		return "", errors.New("filter: too many values")
+	}
+
+	args := make([]any, len(values))
+	bounds := make([]string, len(values))
+	for i, value := range values {
+		args[i], bounds[i] = value, "?"
+		switch fieldType {
+		case "money":
+			if filter.Op == "startsWith" || filter.Op == "contains" {
+				break
+			}
+			amount, ok := MoneyField(field["value"]).Parse(value, session.UserLanguage(compiler.ownerId))
+			if !ok {
+				return "", fmt.Errorf("filter: %s is not an amount", value)
+			}
+			args[i] = strconv.FormatInt(amount, 10)
+		case "formula":
+			bounds[i] = searchFormulaBound(value)
+		}
+	}
+
+	var condition string
+	switch filter.Op {
+	case "eq":
+		condition = fmt.Sprintf("%s = %s", column, bounds[0])
+	case "ne":
+		condition = fmt.Sprintf("%s <> %s", column, bounds[0])
+	case "lt":
+		condition = fmt.Sprintf("%s < %s", column, bounds[0])
+	case "lte":
+		condition = fmt.Sprintf("%s <= %s", column, bounds[0])
+	case "gt":
+		condition = fmt.Sprintf("%s > %s", column, bounds[0])
+	case "gte":
+		condition = fmt.Sprintf("%s >= %s", column, bounds[0])
+	case "in", "notIn":
+		operator := "IN"
+		if filter.Op == "notIn" {
+			operator = "NOT IN"
+		}
+		condition = fmt.Sprintf("%s %s (%s)", column, operator, strings.Join(bounds, ","))
+	case "between":
+		condition = fmt.Sprintf("%s BETWEEN %s AND %s", column, bounds[0], bounds[1])
+	case "isNull":
+		condition = fmt.Sprintf("%s IS NULL", column)
+		if FieldType(fieldType) == "TEXT" && fieldType != "json" && fieldType != "formula" {
+			condition = fmt.Sprintf("(%s IS NULL OR %s = '')", column, column)
+		}
+	case "startsWith", "contains":
+		pattern := filterLikeEscaper.Replace(filter.Value) + "%"
+		if filter.Op == "contains" {
+			pattern = "%" + pattern
+		}
+		args[0] = pattern
+		if fieldType == "formula" {
+			column = searchFormulaText(compiler.engine, column)
+		}
+		like := compiler.engine.SearchLike(column)
+		if fieldType == "reference" {
+			if like = session.referenceSearch(compiler.engine, compiler.ownerId, filter.Field, field["value"]); like == "" {
+				return "", fmt.Errorf("filter: %s cannot be searched", filter.Field)
+			}
+		}
+		// the pattern is the only placeholder of the condition
+		like = strings.Replace(like, "?", "? ESCAPE '"+filterLikeEscape+"'", 1)
+		condition = strings.TrimPrefix(strings.TrimSpace(like), "AND ")
+	default:
+		return "", fmt.Errorf("filter: unknown operator %s", filter.Op)
+	}
+
+	compiler.args = append(compiler.args, args...)
+	return "(" + condition + ")", nil
+}
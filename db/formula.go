@@ -0,0 +1,310 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A formula is an expression over the other fields of the module, it is never
+// stored and is translated into SQL so it can be listed, sorted and searched
+// like any other column. Besides field names it accepts numbers, 'quoted'
+// strings, + - * / and parentheses and the functions in formulaFunctions.
+var formulaFunctions = map[string][2]int{
+	"abs":      {1, 1},
+	"coalesce": {1, -1},
+	"concat":   {1, -1},
+	"days":     {1, 2},
+	"lower":    {1, 1},
+	"round":    {1, 2},
+	"upper":    {1, 1},
+	"years":    {1, 1},
+}
+
+type formulaParser struct {
+	session  *TypeSession
+	engine   TypeEngine
+	fields   map[string]TypeRow
+	visiting map[string]bool
+	tokens   []string
+	pos      int
+}
+
+// FormulaSql translates the formula of a field of moduleId into a SQL
+// expression, formulas can use other formulas as long as they do not loop.
+func (session *TypeSession) FormulaSql(moduleId int64, formula string) (string, error) {
+	return session.formulaSql(moduleId, TypeRow{"value": formula})
+}
+
+// formulaSql translates field, which replaces the stored field with the same
+// name when it has one.
+func (session *TypeSession) formulaSql(moduleId int64, field TypeRow) (string, error) {
+	engine, err := session.engine()
+	if err != nil {
+		return "", err
+	}
+	rows, err := session.Rows("SELECT name, type, value FROM ejaFields WHERE ejaModuleId=?", moduleId)
+	if err != nil {
+		return "", err
+	}
+	parser := &formulaParser{session: session, engine: engine, fields: map[string]TypeRow{}, visiting: map[string]bool{}}
+	for _, row := range rows {
+		parser.fields[row["name"]] = row
+	}
+	if field["name"] != "" {
+		parser.fields[field["name"]] = field
+		parser.visiting[field["name"]] = true
+	}
+	return parser.translate(field["value"])
+}
+
+// FormulaCheck tells whether formula can be used as the formula of the field
+// name of moduleId, before it is saved.
+func (session *TypeSession) FormulaCheck(moduleId int64, name string, formula string) error {
+	_, err := session.formulaSql(moduleId, TypeRow{"name": name, "type": "formula", "value": formula})
+	return err
+}
+
+// formulaValue computes the formula on the stored record ejaId.
+func (session *TypeSession) formulaValue(moduleId int64, formula string, ejaId int64) (string, error) {
+	query, err := session.FormulaSql(moduleId, formula)
+	if err != nil {
+		return "", err
+	}
+	tableName := session.ModuleGetNameById(moduleId)
+	if err := session.TableNameIsValid(tableName); err != nil {
+		return "", err
+	}
+	return session.Value(fmt.Sprintf("SELECT %s FROM %s WHERE ejaId=?", query, tableName), ejaId)
+}
+
+func (parser *formulaParser) translate(formula string) (string, error) {
+	tokens, pos := parser.tokens, parser.pos
+	defer func() { parser.tokens, parser.pos = tokens, pos }()
+
+	var err error
+	if parser.tokens, err = formulaTokens(formula); err != nil {
+		return "", err
+	}
+	if len(parser.tokens) == 0 {
+		return "", errors.New("formula is empty")
+	}
+	parser.pos = 0
+	query, err := parser.sum()
+	if err != nil {
+		return "", err
+	}
+	if parser.pos < len(parser.tokens) {
+		return "", fmt.Errorf("formula: unexpected %s", parser.tokens[parser.pos])
+	}
+	return query, nil
+}
+
+func (parser *formulaParser) peek() string {
+	if parser.pos < len(parser.tokens) {
+		return parser.tokens[parser.pos]
+	}
+	return ""
+}
+
+func (parser *formulaParser) next() string {
+	token := parser.peek()
+	parser.pos++
+	return token
+}
+
+func (parser *formulaParser) sum() (string, error) {
+	left, err := parser.product()
+	if err != nil {
+		return "", err
+	}
+	for parser.peek() == "+" || parser.peek() == "-" {
+		operator := parser.next()
+		right, err := parser.product()
+		if err != nil {
+			return "", err
+		}
+		left = fmt.Sprintf("(%s %s %s)", left, operator, right)
+	}
+	return left, nil
+}
+
+func (parser *formulaParser) product() (string, error) {
+	left, err := parser.unary()
+	if err != nil {
+		return "", err
+	}
+	for parser.peek() == "*" || parser.peek() == "/" {
+		operator := parser.next()
+		right, err := parser.unary()
+		if err != nil {
+			return "", err
+		}
+		if operator == "/" {
+			// no integer division and NULL instead of an error on zero
+			left = fmt.Sprintf("(%s * 1.0 / NULLIF(%s, 0))", left, right)
+		} else {
+			left = fmt.Sprintf("(%s * %s)", left, right)
+		}
+	}
+	return left, nil
+}
+
+func (parser *formulaParser) unary() (string, error) {
+	if parser.peek() == "-" {
+		parser.next()
+		value, err := parser.unary()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(-%s)", value), nil
+	}
+	return parser.primary()
+}
+
+func (parser *formulaParser) primary() (string, error) {
+	token := parser.next()
+	switch {
+	case token == "":
+		return "", errors.New("formula: unexpected end")
+	case token == "(":
+		value, err := parser.sum()
+		if err != nil {
+			return "", err
+		}
+		if parser.next() != ")" {
+			return "", errors.New("formula: missing )")
+		}
+		return value, nil
+	case token[0] == '\'' || (token[0] >= '0' && token[0] <= '9'):
+		return token, nil
+	case parser.peek() == "(":
+		return parser.function(token)
+	}
+	return parser.field(token)
+}
+
+func (parser *formulaParser) function(name string) (string, error) {
+	name = strings.ToLower(name)
+	arity, ok := formulaFunctions[name]
+	if !ok {
+		return "", fmt.Errorf("formula: unknown function %s", name)
+	}
+	parser.next()
+
+	var args []string
+	for parser.peek() != ")" {
+		if len(args) > 0 && parser.next() != "," {
+			return "", fmt.Errorf("formula: missing , in %s", name)
+		}
+		arg, err := parser.sum()
+		if err != nil {
+			return "", err
+		}
+		args = append(args, arg)
+	}
+	parser.next()
+
+	if len(args) < arity[0] || (arity[1] > 0 && len(args) > arity[1]) {
+		return "", fmt.Errorf("formula: wrong number of arguments for %s", name)
+	}
+	query := parser.engine.Formula(name, args)
+	if query == "" {
+		return "", fmt.Errorf("formula: %s is not supported", name)
+	}
+	return query, nil
+}
+
+func (parser *formulaParser) field(name string) (string, error) {
+	if name == "ejaId" || name == "ejaOwner" || name == "ejaLog" {
+		return name, nil
+	}
+	row, ok := parser.fields[name]
+	if !ok {
+		return "", fmt.Errorf("formula: unknown field %s", name)
+	}
+	if row["type"] == "formula" {
+		if parser.visiting[name] {
+			return "", fmt.Errorf("formula: %s refers to itself", name)
+		}
+		parser.visiting[name] = true
+		defer delete(parser.visiting, name)
+		query, err := parser.translate(row["value"])
+		if err != nil {
+			return "", err
+		}
+		return "(" + query + ")", nil
+	}
+	if !fieldHasColumn(row["type"]) {
+		return "", fmt.Errorf("formula: %s has no value", name)
+	}
+	if err := parser.session.FieldNameIsValid(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// formulaTokens splits a formula, strings are kept with their quotes and
+// backslashes are refused since some engines read them as escapes.
+func formulaTokens(formula string) (tokens []string, err error) {
+	for i := 0; i < len(formula); {
+		char := formula[i]
+		switch {
+		case char == ' ' || char == '\t' || char == '\r' || char == '\n':
+			i++
+		case strings.IndexByte("+-*/(),", char) >= 0:
+			tokens = append(tokens, string(char))
+			i++
+		case char == '\'':
+			j := i + 1
+			for ; j < len(formula); j++ {
+				if formula[j] == '\\' {
+					return nil, errors.New("formula: backslash in string")
+				}
+				if formula[j] == '\'' {
+					if j+1 < len(formula) && formula[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(formula) {
+				return nil, errors.New("formula: unterminated string")
+			}
+			tokens = append(tokens, formula[i:j+1])
+			i = j + 1
+		case char >= '0' && char <= '9':
+			j, dot := i, false
+			for j < len(formula) && (formula[j] >= '0' && formula[j] <= '9' || formula[j] == '.' && !dot) {
+				dot = dot || formula[j] == '.'
+				j++
+			}
+			if formula[j-1] == '.' {
+				return nil, fmt.Errorf("formula: bad number %s", formula[i:j])
+			}
+			tokens = append(tokens, formula[i:j])
+			i = j
+		case char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z':
+			j := i
+			for j < len(formula) && (formula[j] == '_' || formula[j] >= 'a' && formula[j] <= 'z' || formula[j] >= 'A' && formula[j] <= 'Z' || formula[j] >= '0' && formula[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, formula[i:j])
+			i = j
+		default:
+			return nil, fmt.Errorf("formula: unexpected %q", char)
+		}
+	}
+	return
+}
+
+// formulaDefault returns the optional argument i or value when it is missing.
+func formulaDefault(args []string, i int, value string) string {
+	if i < len(args) {
+		return args[i]
+	}
+	return value
+}
@@ -0,0 +1,35 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestFormulaTokens tests the splitting of formulas into tokens
+func TestFormulaTokens(t *testing.T) {
+	tests := []struct {
+		formula string
+		want    []string
+	}{
+		{"qty * price", []string{"qty", "*", "price"}},
+		{"round(total / 2, 2)", []string{"round", "(", "total", "/", "2", ",", "2", ")"}},
+		{"1.5+x_2", []string{"1.5", "+", "x_2"}},
+		{"concat(first, ' ', 'it''s')", []string{"concat", "(", "first", ",", "' '", ",", "'it''s'", ")"}},
+		{"\tqty\r\n-1", []string{"qty", "-", "1"}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		got, err := formulaTokens(test.formula)
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("formulaTokens(%q) = %q, %v, want %q", test.formula, got, err, test.want)
+		}
+	}
+
+	for _, formula := range []string{"qty; DROP TABLE x", "'a\\'", "'open", "1.", "1.2.3", "qty % 2", "\"qty\""} {
+		if tokens, err := formulaTokens(formula); err == nil {
+			t.Errorf("formulaTokens(%q) = %q, want an error", formula, tokens)
+		}
+	}
+}
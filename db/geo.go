@@ -0,0 +1,91 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SearchDistance is the column added to the list by a near search, holding
+// the distance in kilometers from the searched point.
+const SearchDistance = "ejaDistance"
+
+const geoEarthRadius = 6371.0
+
+// GeoParse reads a geo field value, "lat,lon" in decimal degrees.
+func GeoParse(value string) (lat float64, lon float64, ok bool) {
+	point, ok := geoNumbers(value, 2)
+	if !ok || point[0] < -90 || point[0] > 90 || point[1] < -180 || point[1] > 180 {
+		return 0, 0, false
+	}
+	return point[0], point[1], true
+}
+
+// geoJson returns a geo field value as a GeoJSON point, nil when it is not valid.
+func geoJson(value string) map[string]any {
+	lat, lon, ok := GeoParse(value)
+	if !ok {
+		return nil
+	}
+	return map[string]any{"type": "Point", "coordinates": []float64{lon, lat}}
+}
+
+// geoNumbers splits value into exactly size comma separated numbers.
+func geoNumbers(value string, size int) ([]float64, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != size {
+		return nil, false
+	}
+	numbers := make([]float64, size)
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, false
+		}
+		numbers[i] = number
+	}
+	return numbers, true
+}
+
+// geoSearch returns the condition of a near search, "lat,lon,km", or of a
+// box one, "lat,lon,lat,lon" with the south west and the north east corners.
+// The numbers are parsed so they are written in the query as they are, near
+// also returns the distance expression to add to the list.
+func geoSearch(engine TypeEngine, fieldName string, mode string, value string) (condition string, distance string, ok bool) {
+	lat, lon := engine.GeoPoint(fieldName)
+	number := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	switch mode {
+	case "near":
+		args, ok := geoNumbers(value, 3)
+		if !ok || args[2] < 0 {
+			return "", "", false
+		}
+		if _, _, ok := GeoParse(number(args[0]) + "," + number(args[1])); !ok {
+			return "", "", false
+		}
+		distance = fmt.Sprintf("(%s * 2 * ASIN(SQRT(POWER(SIN(RADIANS(%s - %s) / 2), 2) + COS(RADIANS(%s)) * COS(RADIANS(%s)) * POWER(SIN(RADIANS(%s - %s) / 2), 2))))",
+			number(geoEarthRadius), lat, number(args[0]), number(args[0]), lat, lon, number(args[1]))
+		return fmt.Sprintf(" AND %s <> '' AND %s <= %s ", fieldName, distance, number(args[2])), distance, true
+	case "box":
+		args, ok := geoNumbers(value, 4)
+		if !ok {
+			return "", "", false
+		}
+		_, _, southWest := GeoParse(number(args[0]) + "," + number(args[1]))
+		_, _, northEast := GeoParse(number(args[2]) + "," + number(args[3]))
+		if !southWest || !northEast || args[0] > args[2] {
+			return "", "", false
+		}
+		lonCondition := fmt.Sprintf("%s BETWEEN %s AND %s", lon, number(args[1]), number(args[3]))
+		if args[1] > args[3] {
+			// the box crosses the antimeridian
+			lonCondition = fmt.Sprintf("(%s >= %s OR %s <= %s)", lon, number(args[1]), lon, number(args[3]))
+		}
+		return fmt.Sprintf(" AND %s <> '' AND %s BETWEEN %s AND %s AND %s ", fieldName, lat, number(args[0]), number(args[2]), lonCondition), "", true
+	}
+	return "", "", false
+}
@@ -0,0 +1,143 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ImageThumbSize is the longest side in pixels of the generated thumbnails.
+var ImageThumbSize = 200
+
+// ImageMaxPixels is the largest image accepted, checked before decoding it.
+var ImageMaxPixels = 40_000_000
+
+var ErrImageNotValid = errors.New("image not valid")
+
+// ImageStore decodes an uploaded image and stores it re-encoded, which drops
+// EXIF and any other metadata, together with a thumbnail. JPEG images stay
+// JPEG while PNG and GIF ones become PNG so transparency is kept.
+func ImageStore(name string, content io.Reader) (file TypeFile, err error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return file, fmt.Errorf("%w: %v", ErrImageNotValid, err)
+	}
+	if config.Width < 1 || config.Height < 1 || config.Width*config.Height > ImageMaxPixels {
+		return file, fmt.Errorf("%w: %dx%d pixels", ErrImageNotValid, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return file, fmt.Errorf("%w: %v", ErrImageNotValid, err)
+	}
+
+	if format != "jpeg" {
+		format = "png"
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + ".png"
+	}
+	full, err := imageEncode(img, format)
+	if err != nil {
+		return
+	}
+	thumb, err := imageEncode(imageResize(img, ImageThumbSize), format)
+	if err != nil {
+		return
+	}
+
+	thumbFile, err := FileStore("thumb."+format, "image/"+format, bytes.NewReader(thumb))
+	if err != nil {
+		return
+	}
+	if file, err = FileStore(name, "image/"+format, bytes.NewReader(full)); err != nil {
+		return
+	}
+	file.Thumb = thumbFile.Hash
+	return file, nil
+}
+
+// ImageParse reads the metadata stored in an image field, ok is false when
+// the value is not a stored image.
+func ImageParse(value string) (TypeFile, bool) {
+	file, ok := FileParse(value)
+	if !ok || !strings.HasPrefix(file.Mime, "image/") || !fileHashRegex.MatchString(file.Thumb) {
+		return TypeFile{}, false
+	}
+	return file, true
+}
+
+// ThumbFile returns the thumbnail of an image as a file of its own.
+func (file TypeFile) ThumbFile() TypeFile {
+	return TypeFile{Name: "thumb-" + file.Name, Mime: file.Mime, Hash: file.Thumb}
+}
+
+// FileUrl returns the address, relative to the web root and without the
+// session, where the file of fieldName in the record ejaId can be downloaded,
+// or the thumbnail of the image when thumb is true.
+func FileUrl(moduleId int64, ejaId int64, fieldName string, thumb bool) string {
+	link := fmt.Sprintf("?ejaModuleId=%d&ejaId=%d&ejaFile=%s", moduleId, ejaId, url.QueryEscape(fieldName))
+	if thumb {
+		link += "&ejaThumb=1"
+	}
+	return link
+}
+
+func imageEncode(img image.Image, format string) ([]byte, error) {
+	var buffer bytes.Buffer
+	var err error
+	if format == "jpeg" {
+		err = jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(&buffer, img)
+	}
+	return buffer.Bytes(), err
+}
+
+// imageResize scales img so that its longest side is at most size, averaging
+// the source pixels covered by each destination one.
+func imageResize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	dstWidth, dstHeight := size, max(1, height*size/width)
+	if height > width {
+		dstWidth, dstHeight = max(1, width*size/height), size
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pixel := src.RGBAAt(sx, sy)
+					r, g, b, a = r+uint64(pixel.R), g+uint64(pixel.G), b+uint64(pixel.B), a+uint64(pixel.A)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,89 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// TypeIndex describes an index on one or more columns of a table.
+type TypeIndex struct {
+	Table  string
+	Fields []string
+	Unique bool
+}
+
+// setupIndexes are created by Setup on the built-in tables, they follow the
+// lookups done by the permission, link and session queries.
+var setupIndexes = []TypeIndex{
+	{Table: "ejaLinks", Fields: []string{"srcModuleId", "srcFieldId", "dstModuleId", "dstFieldId"}},
+	{Table: "ejaLinks", Fields: []string{"dstModuleId", "dstFieldId"}},
+	{Table: "ejaPermissions", Fields: []string{"ejaModuleId", "ejaCommandId"}},
+	{Table: "ejaFields", Fields: []string{"ejaModuleId", "name"}},
+	{Table: "ejaModules", Fields: []string{"name"}},
+	{Table: "ejaModuleLinks", Fields: []string{"srcModuleId", "dstModuleId"}},
+	{Table: "ejaTranslations", Fields: []string{"word", "ejaLanguage"}},
+	{Table: "ejaCommands", Fields: []string{"name"}},
+	{Table: "ejaUsers", Fields: []string{"username"}},
+	{Table: "ejaUsers", Fields: []string{"ejaSession"}},
+	{Table: "ejaSessions", Fields: []string{"ejaOwner", "name"}},
+	{Table: "ejaAudit", Fields: []string{"ejaModuleId", "recordId"}},
+	{Table: "ejaSearches", Fields: []string{"ejaModuleId", "ejaOwner"}},
+}
+
+// IndexName returns the name used for an index on fields, long names are
+// hashed to stay within the 63 characters most engines accept.
+func IndexName(tableName string, fieldNames ...string) string {
+	name := "ejaIdx_" + tableName + "_" + strings.Join(fieldNames, "_")
+	if len(name) > 63 {
+		hash := sha256.Sum256([]byte(name))
+		name = "ejaIdx_" + hex.EncodeToString(hash[:])[:32]
+	}
+	return name
+}
+
+// FieldIndex normalizes the sqlIndex option of a field to "", "index" or "unique".
+func FieldIndex(value string) string {
+	switch value {
+	case "index", "unique":
+		return value
+	default:
+		return ""
+	}
+}
+
+func (session *TypeSession) IndexAdd(index TypeIndex) error {
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
+	if err := session.indexIsValid(engine, index); err != nil {
+		return err
+	}
+	return engine.IndexAdd(session, index.Table, IndexName(index.Table, index.Fields...), index.Fields, index.Unique)
+}
+
+func (session *TypeSession) IndexDel(index TypeIndex) error {
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
+	if err := session.indexIsValid(engine, index); err != nil {
+		return err
+	}
+	return engine.IndexDel(session, index.Table, IndexName(index.Table, index.Fields...))
+}
+
+func (session *TypeSession) indexIsValid(engine TypeEngine, index TypeIndex) error {
+	if err := engine.TableNameIsValid(index.Table); err != nil {
+		return err
+	}
+	for _, field := range index.Fields {
+		if err := engine.FieldNameIsValid(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Rules set in the onDelete field of ejaModuleLinks, deciding what happens to
+// the sub-module records pointing through srcFieldName to a deleted record.
+const (
+	DeleteRestrict = "restrict"
+	DeleteCascade  = "cascade"
+	DeleteSetNull  = "setNull"
+)
+
+// TypeDeleteRestricted is returned when a record cannot be deleted because
+// Count sub-module records still point to it.
+type TypeDeleteRestricted struct {
+	Count int64
+}
+
+func (err TypeDeleteRestricted) Error() string {
+	return "ejaDeleteRestricted"
+}
+
+type typeDependent struct {
+	ModuleId int64
+	Table    string
+	Field    string
+	Rule     string
+}
+
+// dependents returns the sub-modules linked to moduleId, links without a rule
+// or from databases created before the rules existed are restrict.
+func (session *TypeSession) dependents(moduleId int64) (result []typeDependent, err error) {
+	rule := "'' AS onDelete"
+	if check, _ := session.FieldExists("ejaModuleLinks", "onDelete"); check {
+		rule = "onDelete"
+	}
+	rows, err := session.Rows("SELECT srcModuleId, srcFieldName, "+rule+" FROM ejaModuleLinks WHERE dstModuleId=? AND srcFieldName != ''", moduleId)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		srcModuleId := session.Number(row["srcModuleId"])
+		table := session.ModuleGetNameById(srcModuleId)
+		if table == "" || session.TableNameIsValid(table) != nil || session.FieldNameIsValid(row["srcFieldName"]) != nil {
+			continue
+		}
+		if check, _ := session.FieldExists(table, row["srcFieldName"]); !check {
+			continue
+		}
+		dependent := typeDependent{ModuleId: srcModuleId, Table: table, Field: row["srcFieldName"], Rule: DeleteRestrict}
+		if row["onDelete"] == DeleteCascade || row["onDelete"] == DeleteSetNull {
+			dependent.Rule = row["onDelete"]
+		}
+		result = append(result, dependent)
+	}
+	return
+}
+
+// dependentCount counts the records of every owner, trashed ones included,
+// pointing to ejaId through the dependents with one of the given rules.
+func (session *TypeSession) dependentCount(dependents []typeDependent, ejaId int64, rules ...string) (count int64, err error) {
+	for _, dependent := range dependents {
+		if !slices.Contains(rules, dependent.Rule) {
+			continue
+		}
+		value, err := session.Value(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s=?", dependent.Table, dependent.Field), ejaId)
+		if err != nil {
+			return 0, err
+		}
+		count += session.Number(value)
+	}
+	return
+}
+
+// integrityCheck refuses to delete ejaId while restrict links point to it.
+func (session *TypeSession) integrityCheck(moduleId int64, ejaId int64) ([]typeDependent, error) {
+	dependents, err := session.dependents(moduleId)
+	if err != nil {
+		return nil, err
+	}
+	count, err := session.dependentCount(dependents, ejaId, DeleteRestrict)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, TypeDeleteRestricted{Count: count}
+	}
+	return dependents, nil
+}
+
+// integrityApply deletes or clears the records pointing to the deleted ejaId,
+// the ones ownerId cannot change are left in place and block the deletion.
+func (session *TypeSession) integrityApply(ownerId int64, dependents []typeDependent, ejaId int64) error {
+	for _, dependent := range dependents {
+		if dependent.Rule == DeleteRestrict {
+			continue
+		}
+		query := fmt.Sprintf("SELECT ejaId FROM %s WHERE %s=? AND ejaOwner IN (%s)", dependent.Table, dependent.Field, session.OwnersCsv(ownerId, dependent.ModuleId))
+		rows, err := session.Rows(query, ejaId)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if dependent.Rule == DeleteCascade {
+				err = session.remove(ownerId, dependent.ModuleId, session.Number(row["ejaId"]))
+			} else {
+				err = session.Put(ownerId, dependent.ModuleId, session.Number(row["ejaId"]), dependent.Field, nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	count, err := session.dependentCount(dependents, ejaId, DeleteCascade, DeleteSetNull)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return TypeDeleteRestricted{Count: count}
+	}
+	return nil
+}
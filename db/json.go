@@ -0,0 +1,55 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// jsonPathRegex accepts the paths json fields can be searched by, like
+// $.customer.id or $.items[0].price, so they can be written in the query.
+var jsonPathRegex = regexp.MustCompile(`^\$(\.[A-Za-z_][A-Za-z0-9_]*|\[[0-9]+\])+$`)
+
+// jsonPathParts splits a valid path into its keys and indexes.
+func jsonPathParts(path string) (parts []string) {
+	for _, part := range strings.Split(strings.ReplaceAll(strings.TrimPrefix(path, "$"), "[", ".["), ".") {
+		if part != "" {
+			parts = append(parts, strings.Trim(part, "[]"))
+		}
+	}
+	return
+}
+
+// jsonSearch returns the condition and its argument for the search key
+// field.$.path, a trailing .start or .stop turns equality into a range.
+// Numbers are compared as numbers, anything else as text.
+func jsonSearch(engine TypeEngine, fieldName string, path string, value string) (string, any, bool) {
+	operator := "="
+	if trimmed, found := strings.CutSuffix(path, ".start"); found {
+		path, operator = trimmed, ">="
+	} else if trimmed, found := strings.CutSuffix(path, ".stop"); found {
+		path, operator = trimmed, "<="
+	}
+	if !jsonPathRegex.MatchString(path) {
+		return "", nil, false
+	}
+	if number, err := strconv.ParseFloat(value, 64); err == nil {
+		return fmt.Sprintf(" AND %s %s ? ", engine.JsonPath(fieldName, path, true), operator), number, true
+	}
+	return fmt.Sprintf(" AND %s %s ? ", engine.JsonPath(fieldName, path, false), operator), value, true
+}
+
+// jsonSame tells whether two documents hold the same data, engines storing
+// JSON natively do not keep the original spacing.
+func jsonSame(value string, stored string) bool {
+	var a, b any
+	if json.Unmarshal([]byte(value), &a) != nil || json.Unmarshal([]byte(stored), &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,41 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestJsonPath tests the validation and splitting of json search paths
+func TestJsonPath(t *testing.T) {
+	tests := []struct {
+		path  string
+		valid bool
+		parts []string
+	}{
+		{"$.customer", true, []string{"customer"}},
+		{"$.customer.id", true, []string{"customer", "id"}},
+		{"$.items[0].price", true, []string{"items", "0", "price"}},
+		{"$[12]", true, []string{"12"}},
+		{"$._key2", true, []string{"_key2"}},
+		{"$", false, nil},
+		{"customer", false, nil},
+		{"$.", false, nil},
+		{"$.2key", false, nil},
+		{"$.items[a]", false, nil},
+		{"$.items[-1]", false, nil},
+		{"$.customer name", false, nil},
+		{"$.customer') OR 1=1 --", false, nil},
+		{"$.customer.id\n", false, nil},
+	}
+	for _, test := range tests {
+		if valid := jsonPathRegex.MatchString(test.path); valid != test.valid {
+			t.Errorf("jsonPathRegex.MatchString(%q) = %v, want %v", test.path, valid, test.valid)
+			continue
+		}
+		if parts := jsonPathParts(test.path); test.valid && !slices.Equal(parts, test.parts) {
+			t.Errorf("jsonPathParts(%q) = %q, want %q", test.path, parts, test.parts)
+		}
+	}
+}
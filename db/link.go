@@ -2,7 +2,7 @@
 
 package db
 
-import ()
+import "fmt"
 
 type TypeLink struct {
 	Label       string `json:"Label,omitempty"`
@@ -22,13 +22,13 @@ func (session *TypeSession) ModuleLinksFieldName(moduleId, linkModuleId int64) s
 func (session *TypeSession) ModuleLinks(ownerId int64, moduleId int64) (result []TypeLink) {
 	ejaPermissions := session.ModuleGetIdByName("ejaPermissions")
 	ejaUsers := session.ModuleGetIdByName("ejaUsers")
-	rows, err := session.Rows(`
-		SELECT srcModuleId, (SELECT name FROM ejaModules WHERE ejaId=srcModuleId) AS srcModuleName 
+	rows, err := session.Rows(fmt.Sprintf(`
+		SELECT srcModuleId, (SELECT name FROM ejaModules WHERE ejaId=%s) AS srcModuleName 
 		FROM ejaModuleLinks 
 		WHERE dstModuleId=? 
-        AND srcFieldName = ""
+        AND srcFieldName = ''
 		ORDER BY power ASC
-		`, moduleId)
+		`, session.integerSql("srcModuleId")), moduleId)
 	if err != nil {
 		return
 	}
@@ -44,22 +44,37 @@ func (session *TypeSession) ModuleLinks(ownerId int64, moduleId int64) (result [
 }
 
 func (session *TypeSession) LinkDel(ownerId int64, moduleId int64, fieldId int64, linkModuleId int64, linkFieldId int64) error {
-	_, err := session.Run("DELETE FROM ejaLinks WHERE ejaOwner=? AND srcModuleId=? AND srcFieldId=? AND dstModuleId=? AND dstFieldId=?", ownerId, moduleId, fieldId, linkModuleId, linkFieldId)
-	return err
+	run, err := session.Run("DELETE FROM ejaLinks WHERE ejaOwner=? AND srcModuleId=? AND srcFieldId=? AND dstModuleId=? AND dstFieldId=?", ownerId, moduleId, fieldId, linkModuleId, linkFieldId)
+	if err != nil || run.Changes == 0 {
+		return err
+	}
+	return session.audit(ownerId, "linkDel", moduleId, fieldId, "", fmt.Sprintf("%d.%d", linkModuleId, linkFieldId), "")
 }
 
 func (session *TypeSession) LinkAdd(ownerId int64, moduleId int64, fieldId int64, linkModuleId int64, linkFieldId int64) error {
-	_, err := session.Run("INSERT INTO ejaLinks (ejaOwner,ejaLog,srcModuleId,srcFieldId,dstModuleId,dstFieldId,power) VALUES(?,?,?,?,?,?,?)", ownerId, session.Now(), moduleId, fieldId, linkModuleId, linkFieldId, 1)
-	return err
+	if _, err := session.Run("INSERT INTO ejaLinks (ejaOwner,ejaLog,srcModuleId,srcFieldId,dstModuleId,dstFieldId,power) VALUES(?,?,?,?,?,?,?)", ownerId, session.Now(), moduleId, fieldId, linkModuleId, linkFieldId, 1); err != nil {
+		return err
+	}
+	return session.audit(ownerId, "linkAdd", moduleId, fieldId, "", "", fmt.Sprintf("%d.%d", linkModuleId, linkFieldId))
 }
 
-func (session *TypeSession) LinkCopy(userId int64, dstFieldNew int64, dstModule int64, dstFieldOriginal int64) (TypeRun, error) {
-	return session.Run(`
-		INSERT INTO ejaLinks (ejaId, ejaOwner, ejaLog, srcModuleId, srcFieldId, dstModuleId, dstFieldId, power) 
-		SELECT NULL,?,?,srcModuleId,srcFieldId,dstModuleId,?,power 
-		FROM ejaLinks 
-		WHERE dstModuleId=? AND dstFieldId=?
-		`, userId, session.Now(), dstFieldNew, dstModule, dstFieldOriginal)
+func (session *TypeSession) LinkCopy(userId int64, dstFieldNew int64, dstModule int64, dstFieldOriginal int64) (result TypeRun, err error) {
+	rows, err := session.Rows("SELECT srcModuleId, srcFieldId, dstModuleId, power FROM ejaLinks WHERE dstModuleId=? AND dstFieldId=?", dstModule, dstFieldOriginal)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		run, err := session.Run(`
+			INSERT INTO ejaLinks (ejaId, ejaOwner, ejaLog, srcModuleId, srcFieldId, dstModuleId, dstFieldId, power) 
+			VALUES (NULL,?,?,?,?,?,?,?)
+			`, userId, session.Now(), row["srcModuleId"], row["srcFieldId"], row["dstModuleId"], dstFieldNew, row["power"])
+		if err != nil {
+			return result, err
+		}
+		result.Changes += run.Changes
+		result.LastId = run.LastId
+	}
+	return
 }
 
 func (session *TypeSession) SearchLinks(ownerId int64, srcModuleId int64, srcFieldId int64, dstModuleId int64) []string {
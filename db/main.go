@@ -3,9 +3,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log/slog"
+	"sync"
+	"time"
 )
 
 const (
@@ -16,6 +19,28 @@ type TypeSession struct {
 	Handler      *sql.DB
 	Engine       string
 	ConnectionId int64
+	QueryTimeout time.Duration
+	RemoteIp     string
+	conn         *sql.Conn
+	tx           *sql.Tx
+	ctx          context.Context
+	state        *sessionState
+	noAudit      bool
+	savepoints   int
+}
+
+// sessionState is shared by all the copies of a pinned session and keeps the
+// first cancellation or timeout met by one of its statements.
+type sessionState struct {
+	mutex sync.Mutex
+	err   error
+}
+
+// TypeQuerier is satisfied by the connection pool, a single pinned connection and a transaction.
+type TypeQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 }
 
 func Session() TypeSession {
@@ -27,22 +52,13 @@ func (session *TypeSession) Open(engine string, database string, username string
 		return errors.New("database name/file is mandatory")
 	}
 
-	switch engine {
-	case "sqlite":
-		session.Handler, err = sqliteOpen(database)
-	case "mysql":
-		if username != "" && password != "" {
-			session.Handler, err = mysqlOpen(database, username, password, host, port)
-			if err == nil {
-				_, err = session.Handler.Exec("SET sql_mode = 'PIPES_AS_CONCAT'")
-			}
-		} else {
-			return errors.New("username/password missing")
-		}
-	default:
+	dbEngine, ok := Engines[engine]
+	if !ok {
 		return errors.New("unsupported database engine")
 	}
 
+	session.Handler, err = dbEngine.Open(database, username, password, host, port)
+
 	if err == nil {
 		session.Engine = engine
 		session.ConnectionId += 1
@@ -52,102 +68,200 @@ func (session *TypeSession) Open(engine string, database string, username string
 	return
 }
 
-func (session *TypeSession) Close() error {
-	if session.Handler != nil {
-		slog.Debug("DB close", "engine", session.Engine)
-		return session.Handler.Close()
+// SetPool tunes the connection pool, zero values keep the engine defaults.
+func (session *TypeSession) SetPool(maxOpen int, maxIdle int, maxLifetime time.Duration) {
+	if session.Handler == nil {
+		return
+	}
+	if maxOpen > 0 {
+		session.Handler.SetMaxOpenConns(maxOpen)
+	}
+	if maxIdle > 0 {
+		session.Handler.SetMaxIdleConns(maxIdle)
+	}
+	if maxLifetime > 0 {
+		session.Handler.SetConnMaxLifetime(maxLifetime)
 	}
-	return errors.New("no database connection to close")
 }
 
-func (session *TypeSession) Run(query string, args ...any) (result TypeRun, err error) {
-	switch session.Engine {
-	case "sqlite":
-		result, err = session.sqliteRun(query, args...)
-	case "mysql":
-		result, err = session.mysqlRun(query, args...)
-	default:
-		err = errors.New("engine not found")
+// Conn returns a copy of the session pinned to a single pooled connection, so
+// that connection scoped state such as temporary tables survives between
+// queries. Close gives the connection back to the pool.
+func (session *TypeSession) Conn() (TypeSession, error) {
+	if session.Handler == nil {
+		return TypeSession{}, errors.New("no database connection")
+	}
+	conn, err := session.Handler.Conn(session.Context())
+	if err != nil {
+		return TypeSession{}, err
 	}
+	pinned := *session
+	pinned.conn = conn
+	pinned.state = &sessionState{}
+	return pinned, nil
+}
 
+// WithContext returns a copy of the session whose statements are bound to ctx.
+func (session *TypeSession) WithContext(ctx context.Context) TypeSession {
+	bound := *session
+	bound.ctx = ctx
+	return bound
+}
+
+func (session *TypeSession) Context() context.Context {
+	if session.ctx != nil {
+		return session.ctx
+	}
+	return context.Background()
+}
+
+// Err reports the first statement of a pinned session that has been cancelled
+// or has exceeded QueryTimeout.
+func (session *TypeSession) Err() error {
+	if session.state == nil {
+		return nil
+	}
+	session.state.mutex.Lock()
+	defer session.state.mutex.Unlock()
+	return session.state.err
+}
+
+// statement returns a copy of the session bound to ctx and limited by QueryTimeout.
+func (session *TypeSession) statement(ctx context.Context) (*TypeSession, context.CancelFunc) {
+	bound := session.WithContext(ctx)
+	if session.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		bound.ctx, cancel = context.WithTimeout(ctx, session.QueryTimeout)
+		return &bound, cancel
+	}
+	return &bound, func() {}
+}
+
+func (session *TypeSession) log(query string, args []any, err error) {
 	if err != nil {
+		if session.state != nil && (errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)) {
+			session.state.mutex.Lock()
+			if session.state.err == nil {
+				session.state.err = err
+			}
+			session.state.mutex.Unlock()
+		}
 		slog.Error(query, "args", args, "error", err)
 	} else {
 		slog.Debug(query, "args", args)
 	}
+}
+
+func (session *TypeSession) Querier() TypeQuerier {
+	if session.tx != nil {
+		return session.tx
+	}
+	if session.conn != nil {
+		return session.conn
+	}
+	return session.Handler
+}
+
+func (session *TypeSession) Close() error {
+	if session.conn != nil {
+		err := session.conn.Close()
+		session.conn = nil
+		return err
+	}
+	if session.Handler != nil {
+		slog.Debug("DB close", "engine", session.Engine)
+		return session.Handler.Close()
+	}
+	return errors.New("no database connection to close")
+}
+
+func (session *TypeSession) Run(query string, args ...any) (TypeRun, error) {
+	return session.RunContext(session.Context(), query, args...)
+}
+
+func (session *TypeSession) RunContext(ctx context.Context, query string, args ...any) (result TypeRun, err error) {
+	engine, err := session.engine()
+	if err == nil {
+		bound, cancel := session.statement(ctx)
+		defer cancel()
+		result, err = engine.Run(bound, query, args...)
+	}
+
+	session.log(query, args, err)
 	return
 }
 
-func (session *TypeSession) Value(query string, args ...any) (result string, err error) {
-	switch session.Engine {
-	case "sqlite":
-		result, err = session.sqliteValue(query, args...)
-	case "mysql":
-		result, err = session.mysqlValue(query, args...)
-	default:
-		err = errors.New("engine not found")
+func (session *TypeSession) Value(query string, args ...any) (string, error) {
+	return session.ValueContext(session.Context(), query, args...)
+}
+
+func (session *TypeSession) ValueContext(ctx context.Context, query string, args ...any) (result string, err error) {
+	engine, err := session.engine()
+	if err == nil {
+		bound, cancel := session.statement(ctx)
+		defer cancel()
+		result, err = engine.Value(bound, query, args...)
 	}
 	if err == sql.ErrNoRows {
 		err = nil
 	}
 
-	if err != nil {
-		slog.Error(query, "args", args, "error", err)
-	} else {
-		slog.Debug(query, "args", args)
-	}
+	session.log(query, args, err)
 	return
 }
 
-func (session *TypeSession) Row(query string, args ...any) (result TypeRow, err error) {
-	switch session.Engine {
-	case "sqlite":
-		result, err = session.sqliteRow(query, args...)
-	case "mysql":
-		result, err = session.mysqlRow(query, args...)
-	default:
-		err = errors.New("engine not found")
+func (session *TypeSession) Row(query string, args ...any) (TypeRow, error) {
+	return session.RowContext(session.Context(), query, args...)
+}
+
+func (session *TypeSession) RowContext(ctx context.Context, query string, args ...any) (result TypeRow, err error) {
+	engine, err := session.engine()
+	if err == nil {
+		bound, cancel := session.statement(ctx)
+		defer cancel()
+		result, err = engine.Row(bound, query, args...)
 	}
 	if err == sql.ErrNoRows {
 		err = nil
 	}
 
-	if err != nil {
-		slog.Error(query, "args", args, "error", err)
-	} else {
-		slog.Debug(query, "args", args)
-	}
+	session.log(query, args, err)
 	return
 }
 
-func (session *TypeSession) Rows(query string, args ...any) (result TypeRows, err error) {
-	switch session.Engine {
-	case "sqlite":
-		result, err = session.sqliteRows(query, args...)
-	case "mysql":
-		result, err = session.mysqlRows(query, args...)
-	default:
-		err = errors.New("engine not found")
+func (session *TypeSession) Rows(query string, args ...any) (TypeRows, error) {
+	return session.RowsContext(session.Context(), query, args...)
+}
+
+func (session *TypeSession) RowsContext(ctx context.Context, query string, args ...any) (result TypeRows, err error) {
+	engine, err := session.engine()
+	if err == nil {
+		bound, cancel := session.statement(ctx)
+		defer cancel()
+		result, err = engine.Rows(bound, query, args...)
 	}
 	if err == sql.ErrNoRows {
 		err = nil
 	}
 
-	if err != nil {
-		slog.Error(query, "args", args, "error", err)
-	} else {
-		slog.Debug(query, "args", args)
-	}
+	session.log(query, args, err)
 	return
 }
 
 func (session *TypeSession) Cols(query string, args ...any) ([]string, error) {
-	switch session.Engine {
-	case "sqlite":
-		return session.sqliteCols(query, args...)
-	case "mysql":
-		return session.mysqlCols(query, args...)
-	default:
-		return nil, errors.New("engine not found")
+	return session.ColsContext(session.Context(), query, args...)
+}
+
+func (session *TypeSession) ColsContext(ctx context.Context, query string, args ...any) (result []string, err error) {
+	engine, err := session.engine()
+	if err != nil {
+		return nil, err
 	}
+	bound, cancel := session.statement(ctx)
+	defer cancel()
+	result, err = engine.Cols(bound, query, args...)
+	if err != nil {
+		session.log(query, args, err)
+	}
+	return
 }
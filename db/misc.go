@@ -86,14 +86,13 @@ func (session *TypeSession) SelectToRows(value string) []TypeSelect {
 
 func (session *TypeSession) SelectSqlToRows(query string) []TypeSelect {
 	var result []TypeSelect
-	cols, err := session.Cols(query)
-	if err == nil {
-		rows, err := session.Rows(query)
-		if err == nil {
-			for _, row := range rows {
-				result = append(result, TypeSelect{row[cols[0]], row[cols[1]]})
-			}
-		}
+	rows, err := session.Query(query)
+	if err != nil || len(rows.Columns) == 0 {
+		return result
+	}
+	label := min(1, len(rows.Columns)-1)
+	for _, row := range rows.Rows {
+		result = append(result, TypeSelect{row[0].Text, row[label].Text})
 	}
 	return result
 }
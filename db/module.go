@@ -10,6 +10,7 @@ type TypeModule struct {
 	Translation []TypeModuleTranslation `json:"translation,omitempty"`
 	Name        string                  `json:"name"`
 	Data        []map[string]any        `json:"data,omitempty"`
+	Files       map[string][]byte       `json:"files,omitempty"`
 	Type        string                  `json:"type"`
 }
 
@@ -19,6 +20,7 @@ type TypeModuleModule struct {
 	SearchLimit int64  `json:"searchLimit"`
 	SqlCreated  int64  `json:"sqlCreated"`
 	SortList    string `json:"sortList,omitempty"`
+	Trash       int64  `json:"trash,omitempty"`
 }
 
 type TypeModuleField struct {
@@ -32,6 +34,15 @@ type TypeModuleField struct {
 	SizeSearch  int64  `json:"sizeSearch"`
 	SizeList    int64  `json:"sizeList"`
 	SizeEdit    int64  `json:"sizeEdit"`
+	SqlIndex    string `json:"sqlIndex,omitempty"`
+	Required    int64  `json:"required,omitempty"`
+	ValueMin    string `json:"valueMin,omitempty"`
+	ValueMax    string `json:"valueMax,omitempty"`
+	LengthMin   int64  `json:"lengthMin,omitempty"`
+	LengthMax   int64  `json:"lengthMax,omitempty"`
+	Pattern     string `json:"pattern,omitempty"`
+	ValueUnique int64  `json:"valueUnique,omitempty"`
+	Aggregate   string `json:"aggregate,omitempty"`
 }
 
 type TypeModuleTranslation struct {
@@ -46,6 +57,7 @@ type TypeModuleLink struct {
 	SrcModule string `json:"srcModule"`
 	DstModule string `json:"dstModule"`
 	Power     int64  `json:"power,omitempty"`
+	OnDelete  string `json:"onDelete,omitempty"`
 }
 
 func (session *TypeSession) ModuleGetIdByName(name string) int64 {
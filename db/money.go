@@ -0,0 +1,148 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TypeMoney is the configuration of a money field, read from its value as a
+// currency code optionally followed by the number of decimals, like EUR or
+// BTC:8. Amounts are stored as integers in minor units so they never drift.
+type TypeMoney struct {
+	Currency string
+	Scale    int
+}
+
+// moneyScales lists the currencies without the usual two decimals.
+var moneyScales = map[string]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0, "KWD": 3, "OMR": 3, "TND": 3, "VND": 0,
+}
+
+// moneySeparators holds the decimal and group separators of the languages
+// that do not write amounts like English.
+var moneySeparators = map[string][2]string{
+	"de": {",", "."},
+	"es": {",", "."},
+	"fr": {",", " "},
+	"it": {",", "."},
+	"nl": {",", "."},
+	"pt": {",", "."},
+}
+
+var moneyPlainRegex = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// MoneyField reads the configuration stored in the value of a money field.
+func MoneyField(value string) TypeMoney {
+	currency, scale, found := strings.Cut(strings.TrimSpace(value), ":")
+	money := TypeMoney{Currency: strings.ToUpper(strings.TrimSpace(currency)), Scale: 2}
+	if known, ok := moneyScales[money.Currency]; ok {
+		money.Scale = known
+	}
+	if found {
+		if number, err := strconv.Atoi(strings.TrimSpace(scale)); err == nil && number >= 0 && number <= 8 {
+			money.Scale = number
+		}
+	}
+	return money
+}
+
+// Parse converts an amount written by a user of language into minor units,
+// plain numbers like 1234.5 are always accepted as long as they do not have
+// more decimals than the currency, which tells them apart from 1.234 written
+// with a dot as group separator.
+func (money TypeMoney) Parse(value string, language string) (int64, bool) {
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "").Replace(value)
+	if money.Currency != "" {
+		value = strings.ReplaceAll(strings.ToUpper(value), money.Currency, "")
+	}
+	if value == "" {
+		return 0, false
+	}
+
+	if !moneyPlainRegex.MatchString(value) || !money.fits(value) {
+		separators := moneySeparator(language)
+		value = strings.ReplaceAll(value, separators[1], "")
+		value = strings.Replace(value, separators[0], ".", 1)
+		if !moneyPlainRegex.MatchString(value) || !money.fits(value) {
+			return 0, false
+		}
+	}
+
+	whole, fraction, _ := strings.Cut(value, ".")
+	amount, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", money.Scale-len(fraction)), 10, 64)
+	return amount, err == nil
+}
+
+// String writes an amount in minor units as a plain number, like 1234.50.
+func (money TypeMoney) String(amount int64) string {
+	sign, digits := money.digits(amount)
+	if money.Scale == 0 {
+		return sign + digits
+	}
+	return sign + digits[:len(digits)-money.Scale] + "." + digits[len(digits)-money.Scale:]
+}
+
+// Format writes an amount in minor units the way users of language do,
+// followed by the currency code.
+func (money TypeMoney) Format(amount int64, language string) string {
+	separators := moneySeparator(language)
+	sign, digits := money.digits(amount)
+	whole, fraction := digits[:len(digits)-money.Scale], digits[len(digits)-money.Scale:]
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(separators[1])
+		}
+		grouped.WriteRune(digit)
+	}
+
+	result := sign + grouped.String()
+	if fraction != "" {
+		result += separators[0] + fraction
+	}
+	if money.Currency != "" {
+		result += " " + money.Currency
+	}
+	return result
+}
+
+// digits returns the sign and the absolute amount with at least one digit
+// before the decimals.
+func (money TypeMoney) digits(amount int64) (string, string) {
+	sign := ""
+	digits := strconv.FormatInt(amount, 10)
+	if amount < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	if len(digits) <= money.Scale {
+		digits = strings.Repeat("0", money.Scale-len(digits)+1) + digits
+	}
+	return sign, digits
+}
+
+func (money TypeMoney) fits(value string) bool {
+	_, fraction, _ := strings.Cut(value, ".")
+	return len(fraction) <= money.Scale
+}
+
+func moneySeparator(language string) [2]string {
+	if separators, ok := moneySeparators[strings.ToLower(language)]; ok {
+		return separators
+	}
+	return [2]string{".", ","}
+}
+
+// UserLanguage returns the language of the user, used to format amounts.
+func (session *TypeSession) UserLanguage(ownerId int64) string {
+	language, _ := session.Value("SELECT ejaLanguage FROM ejaUsers WHERE ejaId=?", ownerId)
+	return language
+}
+
+// MoneyGet returns the configuration of the money field fieldName of moduleId.
+func (session *TypeSession) MoneyGet(moduleId int64, fieldName string) TypeMoney {
+	return MoneyField(session.fieldValueGet(moduleId, fieldName))
+}
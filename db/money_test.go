@@ -0,0 +1,62 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import "testing"
+
+// TestMoneyParse tests reading the amounts written by users into minor units
+func TestMoneyParse(t *testing.T) {
+	tests := []struct {
+		config   string
+		value    string
+		language string
+		amount   int64
+		ok       bool
+	}{
+		{"EUR", "1234.5", "en", 123450, true},
+		{"EUR", "1,234.56", "en", 123456, true},
+		{"EUR", "1.234,56", "it", 123456, true},
+		{"EUR", "1.234", "it", 123400, true},
+		{"EUR", "1 234,5", "fr", 123450, true},
+		{"EUR", "12 EUR", "en", 1200, true},
+		{"eur", "-3.5", "en", -350, true},
+		{"EUR", "-0,05", "de", -5, true},
+		{"JPY", "1500", "en", 1500, true},
+		{"JPY", "1500.5", "en", 0, false},
+		{"JPY", "1.234", "it", 1234, true},
+		{"BTC:8", "0.00000001", "en", 1, true},
+		{"EUR:9", "1.001", "en", 0, false},
+		{"", "7", "", 700, true},
+		{"EUR", "", "en", 0, false},
+		{"EUR", "EUR", "en", 0, false},
+		{"EUR", "abc", "en", 0, false},
+		{"EUR", "1,2,3", "it", 0, false},
+		{"EUR", "1,005", "en", 100500, true},
+	}
+	for _, test := range tests {
+		amount, ok := MoneyField(test.config).Parse(test.value, test.language)
+		if amount != test.amount || ok != test.ok {
+			t.Errorf("MoneyField(%q).Parse(%q, %q) = %d, %v, want %d, %v", test.config, test.value, test.language, amount, ok, test.amount, test.ok)
+		}
+	}
+}
+
+// TestMoneyFormat tests writing minor units back in the user locale
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		config   string
+		amount   int64
+		language string
+		value    string
+	}{
+		{"EUR", 123456, "it", "1.234,56 EUR"},
+		{"EUR", 123450, "en", "1,234.50 EUR"},
+		{"EUR", -5, "en", "-0.05 EUR"},
+		{"JPY", 1234, "en", "1,234 JPY"},
+	}
+	for _, test := range tests {
+		if value := MoneyField(test.config).Format(test.amount, test.language); value != test.value {
+			t.Errorf("MoneyField(%q).Format(%d, %q) = %q, want %q", test.config, test.amount, test.language, value, test.value)
+		}
+	}
+}
@@ -7,105 +7,40 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/go-sql-driver/mysql"
 )
 
-func mysqlOpen(database string, username string, password string, host string, port int) (*sql.DB, error) {
-	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", username, password, host, port, database)
-	return sql.Open("mysql", connectionString)
-}
-
-func (session *TypeSession) mysqlRun(query string, args ...any) (TypeRun, error) {
-	result, err := session.Handler.Exec(query, args...)
-	if err != nil {
-		return TypeRun{}, err
-	}
-	lastId, _ := result.LastInsertId()
-	changes, _ := result.RowsAffected()
-	return TypeRun{Changes: changes, LastId: lastId}, nil
-}
-
-func (session *TypeSession) mysqlValue(query string, args ...any) (result string, err error) {
-	var nullResult sql.NullString
-	err = session.Handler.QueryRow(query, args...).Scan(&nullResult)
-	if err != nil {
-		return
-	}
-	if nullResult.Valid {
-		result = nullResult.String
-	} else {
-		result = ""
-	}
-
-	return
-}
+var (
+	mysqlValidTableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`)
+	mysqlValidFieldNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`)
+	mysqlWindowCount         sync.Map
+)
 
-func (session *TypeSession) mysqlRow(query string, args ...any) (TypeRow, error) {
-	var result TypeRow
-	rows, err := session.mysqlRows(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	for _, row := range rows {
-		result = row
-		break
-	}
-	return result, nil
+type mysqlEngine struct {
+	TypeEngineSql
 }
 
-func (session *TypeSession) mysqlRows(query string, args ...any) (TypeRows, error) {
-	rows, err := session.Handler.Query(query, args...)
-	if err != nil {
-		return nil, err
+func (engine *mysqlEngine) Open(database string, username string, password string, host string, port int) (*sql.DB, error) {
+	if username == "" || password == "" {
+		return nil, errors.New("username/password missing")
 	}
-	defer rows.Close()
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, err
+	if port < 1 {
+		port = 3306
 	}
-
-	var result TypeRows
-	values := make([]sql.RawBytes, len(columns))
-	scanArgs := make([]any, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
-	}
-
-	for rows.Next() {
-		err := rows.Scan(scanArgs...)
-		if err != nil {
-			return nil, err
-		}
-
-		row := make(TypeRow)
-		for i, col := range values {
-			row[columns[i]] = string(col)
-		}
-
-		result = append(result, row)
-	}
-
-	return result, nil
-}
-
-func (session *TypeSession) mysqlCols(query string, args ...any) ([]string, error) {
-	rows, err := session.Handler.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	return rows.Columns()
+	connectionString := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?sql_mode=%%27PIPES_AS_CONCAT%%27", username, password, host, port, database)
+	return sql.Open("mysql", connectionString)
 }
 
-func (session *TypeSession) mysqlTableExists(name string) (bool, error) {
-	if err := mysqlTableNameIsValid(name); err != nil {
+func (engine *mysqlEngine) TableExists(session *TypeSession, name string) (bool, error) {
+	if err := engine.TableNameIsValid(name); err != nil {
 		return false, err
 	}
 
-	rows, err := session.Handler.Query(`SELECT 1 FROM ` + name + ` LIMIT 1`)
+	rows, err := session.Querier().QueryContext(session.Context(), `SELECT 1 FROM `+name+` LIMIT 1`)
 	if err != nil {
 		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1146 {
 			return false, nil
@@ -117,16 +52,16 @@ func (session *TypeSession) mysqlTableExists(name string) (bool, error) {
 	return true, nil
 }
 
-func (session *TypeSession) mysqlFieldExists(tableName, fieldName string) (bool, error) {
-	if err := mysqlTableNameIsValid(tableName); err != nil {
+func (engine *mysqlEngine) FieldExists(session *TypeSession, tableName, fieldName string) (bool, error) {
+	if err := engine.TableNameIsValid(tableName); err != nil {
 		return false, err
 	}
 
-	if err := mysqlFieldNameIsValid(fieldName); err != nil {
+	if err := engine.FieldNameIsValid(fieldName); err != nil {
 		return false, err
 	}
 
-	rows, err := session.mysqlRows(fmt.Sprintf("SHOW COLUMNS FROM %s LIKE '%s'", tableName, fieldName))
+	rows, err := engine.Rows(session, fmt.Sprintf("SHOW COLUMNS FROM %s LIKE '%s'", tableName, fieldName))
 	if err != nil {
 		return false, err
 	}
@@ -136,33 +71,31 @@ func (session *TypeSession) mysqlFieldExists(tableName, fieldName string) (bool,
 	return false, nil
 }
 
-func mysqlTableNameIsValid(name string) error {
-	check, err := regexp.MatchString(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`, name)
-	if err != nil {
-		return err
+func (engine *mysqlEngine) TableAdd(tableName string, temporary bool) []string {
+	return []string{
+		fmt.Sprintf("CREATE %s TABLE %s (ejaId INTEGER AUTO_INCREMENT PRIMARY KEY, ejaOwner INTEGER, ejaLog DATETIME)", engineTemporary(temporary), tableName),
 	}
-	if !check {
+}
+
+func (engine *mysqlEngine) TableNameIsValid(name string) error {
+	if !mysqlValidTableNameRegex.MatchString(name) {
 		return errors.New("table name is not valid")
 	}
 	return nil
 }
 
-func mysqlFieldNameIsValid(name string) error {
-	check, err := regexp.MatchString(`^[a-zA-Z_][a-zA-Z0-9_]{0,63}$`, name)
-	if err != nil {
-		return err
-	}
-	if !check {
+func (engine *mysqlEngine) FieldNameIsValid(name string) error {
+	if !mysqlValidFieldNameRegex.MatchString(name) {
 		return errors.New("field name is not valid")
 	}
 	return nil
 }
 
-func (session *TypeSession) mysqlFtsAdd(tableName, columnName string) error {
-	if err := mysqlTableNameIsValid(tableName); err != nil {
+func (engine *mysqlEngine) FtsAdd(session *TypeSession, tableName, columnName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
 		return err
 	}
-	if err := mysqlFieldNameIsValid(columnName); err != nil {
+	if err := engine.FieldNameIsValid(columnName); err != nil {
 		return err
 	}
 
@@ -171,15 +104,149 @@ func (session *TypeSession) mysqlFtsAdd(tableName, columnName string) error {
 	var count int
 	query := `SELECT COUNT(*) FROM information_schema.STATISTICS 
 	          WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
-	session.Handler.QueryRow(query, tableName, indexName).Scan(&count)
+	session.Querier().QueryRowContext(session.Context(), query, tableName, indexName).Scan(&count)
 
 	if count == 0 {
 		addIndexQuery := fmt.Sprintf(
 			"ALTER TABLE %s ADD FULLTEXT INDEX %s (%s)",
 			tableName, indexName, columnName,
 		)
-		session.Handler.Exec(addIndexQuery)
+		session.Querier().ExecContext(session.Context(), addIndexQuery)
+	}
+
+	return nil
+}
+
+func (engine *mysqlEngine) FtsDel(session *TypeSession, tableName, columnName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	if err := engine.FieldNameIsValid(columnName); err != nil {
+		return err
 	}
 
+	indexName := "ejaFTS_" + columnName
+
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.STATISTICS 
+	          WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+	if err := session.Querier().QueryRowContext(session.Context(), query, tableName, indexName).Scan(&count); err != nil {
+		return err
+	}
+
+	if count > 0 {
+		_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("ALTER TABLE %s DROP INDEX %s", tableName, indexName))
+		return err
+	}
 	return nil
 }
+
+// IndexAdd indexes TEXT columns on their first 191 characters, the longest
+// utf8mb4 prefix every InnoDB row format accepts.
+func (engine *mysqlEngine) IndexAdd(session *TypeSession, tableName string, indexName string, fieldNames []string, unique bool) error {
+	if check, err := engine.indexExists(session, tableName, indexName); err != nil || check {
+		return err
+	}
+
+	columns := make([]string, len(fieldNames))
+	for i, fieldName := range fieldNames {
+		var dataType string
+		query := `SELECT DATA_TYPE FROM information_schema.COLUMNS 
+		          WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+		if err := session.Querier().QueryRowContext(session.Context(), query, tableName, fieldName).Scan(&dataType); err != nil {
+			return err
+		}
+		columns[i] = fieldName
+		if strings.HasSuffix(strings.ToLower(dataType), "text") || strings.HasSuffix(strings.ToLower(dataType), "blob") {
+			columns[i] = fieldName + "(191)"
+		}
+	}
+
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("ALTER TABLE %s ADD %s %s (%s)", tableName, kind, indexName, strings.Join(columns, ", ")))
+	return err
+}
+
+func (engine *mysqlEngine) IndexDel(session *TypeSession, tableName string, indexName string) error {
+	if check, err := engine.indexExists(session, tableName, indexName); err != nil || !check {
+		return err
+	}
+	_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("ALTER TABLE %s DROP INDEX %s", tableName, indexName))
+	return err
+}
+
+func (engine *mysqlEngine) indexExists(session *TypeSession, tableName string, indexName string) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.STATISTICS 
+	          WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?`
+	if err := session.Querier().QueryRowContext(session.Context(), query, tableName, indexName).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (engine *mysqlEngine) FieldRetype(session *TypeSession, tableName string, fieldName string, sqlType string) error {
+	_, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("ALTER TABLE %s MODIFY %s %s", tableName, fieldName, sqlType))
+	return err
+}
+
+func (engine *mysqlEngine) SearchFts(tableName string, fieldName string) string {
+	return fmt.Sprintf(` AND MATCH(%s) AGAINST(? IN NATURAL LANGUAGE MODE) `, fieldName)
+}
+
+func (engine *mysqlEngine) FieldType(fieldType string) string {
+	switch fieldType {
+	case "json":
+		return "JSON"
+	case "money":
+		return "BIGINT"
+	}
+	return engine.TypeEngineSql.FieldType(fieldType)
+}
+
+func (engine *mysqlEngine) JsonPath(fieldName string, path string, numeric bool) string {
+	value := fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(%s, '%s'))", fieldName, path)
+	if numeric {
+		return fmt.Sprintf("CAST(%s AS DECIMAL(65,10))", value)
+	}
+	return value
+}
+
+func (engine *mysqlEngine) Formula(function string, args []string) string {
+	switch function {
+	case "concat":
+		return fmt.Sprintf("CONCAT_WS('', %s)", strings.Join(args, ", "))
+	case "years":
+		return fmt.Sprintf("TIMESTAMPDIFF(YEAR, %s, CURDATE())", args[0])
+	case "days":
+		return fmt.Sprintf("DATEDIFF(%s, %s)", formulaDefault(args, 1, "CURDATE()"), args[0])
+	}
+	return engine.TypeEngineSql.Formula(function, args)
+}
+
+// WindowCount is available from MySQL 8.0 and MariaDB 10.2, the answer is kept per pool.
+func (engine *mysqlEngine) WindowCount(session *TypeSession) bool {
+	if check, ok := mysqlWindowCount.Load(session.Handler); ok {
+		return check.(bool)
+	}
+
+	var version string
+	if err := session.Querier().QueryRowContext(session.Context(), "SELECT VERSION()").Scan(&version); err != nil {
+		return false
+	}
+	numbers := strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3)
+	major, _ := strconv.Atoi(numbers[0])
+	minor := 0
+	if len(numbers) > 1 {
+		minor, _ = strconv.Atoi(numbers[1])
+	}
+	check := major >= 8
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		check = major > 10 || (major == 10 && minor >= 2)
+	}
+	mysqlWindowCount.Store(session.Handler, check)
+	return check
+}
@@ -33,7 +33,7 @@ func (session *TypeSession) ModulePath(ownerId int64, moduleId int64) (result []
 				WHERE 
 					srcModuleId=? 
 					AND srcFieldId IN (SELECT ejaId FROM ejaPermissions WHERE ejaModuleId=?) 
-					AND ((dstFieldId=? AND dstModuleId=?) || (dstModuleId=? AND dstFieldId IN (%s)))
+					AND ((dstFieldId=? AND dstModuleId=?) OR (dstModuleId=? AND dstFieldId IN (%s)))
 				LIMIT 1
 				`, owners)
 			checkId, _ := session.Value(query, ejaPermissions, session.Number(row["ejaId"]), ownerId, ejaUsers, ejaGroups)
@@ -0,0 +1,431 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+var (
+	postgresValidTableNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,62}$`)
+	postgresValidFieldNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,62}$`)
+)
+
+// postgresIdDefault fills ejaId from its sequence when an insert sets it to
+// NULL, as sqlite and mysql do.
+const postgresIdDefault = `CREATE OR REPLACE FUNCTION "ejaIdDefault"() RETURNS trigger AS $$
+	BEGIN
+		IF NEW."ejaId" IS NULL THEN
+			NEW."ejaId" := nextval(pg_get_serial_sequence(quote_ident(TG_TABLE_SCHEMA) || '.' || quote_ident(TG_TABLE_NAME), 'ejaId'));
+		END IF;
+		RETURN NEW;
+	END $$ LANGUAGE plpgsql`
+
+// postgresIdMissing is the error message of an insert returning ejaId on a
+// table that does not have it.
+const postgresIdMissing = `column "ejaId" does not exist`
+
+type postgresEngine struct {
+	TypeEngineSql
+}
+
+func (engine *postgresEngine) Open(database string, username string, password string, host string, port int) (*sql.DB, error) {
+	if username == "" {
+		return nil, errors.New("username missing")
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if port < 1 {
+		port = 5432
+	}
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(username, password),
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   database,
+	}
+
+	db, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	if err := postgresIdDefaultAdd(db); err != nil {
+		slog.Warn("postgres ejaId trigger function not available", "error", err)
+	}
+
+	return db, nil
+}
+
+func postgresIdDefaultAdd(db *sql.DB) error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pg_proc WHERE proname = 'ejaIdDefault' AND pronamespace = current_schema()::regnamespace`).Scan(&count); err != nil || count > 0 {
+		return err
+	}
+	_, err := db.Exec(postgresIdDefault)
+	return err
+}
+
+// postgresQuery rewrites the ? placeholders into the $n form and quotes the
+// camelCase identifiers, which postgres would otherwise fold to lower case,
+// leaving quoted strings and identifiers untouched. Words in lower or upper
+// case only are kept as they are, the latter being SQL keywords.
+func postgresQuery(query string) string {
+	var result strings.Builder
+	runes := []rune(query)
+	n := 0
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case char == '\'' || char == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != char {
+				end++
+			}
+			end = min(end+1, len(runes))
+			result.WriteString(string(runes[i:end]))
+			i = end - 1
+		case char == '?':
+			n++
+			result.WriteString("$" + strconv.Itoa(n))
+		case postgresWord(char):
+			end := i + 1
+			for end < len(runes) && (postgresWord(runes[end]) || unicode.IsDigit(runes[end])) {
+				end++
+			}
+			word := string(runes[i:end])
+			if !unicode.IsDigit(char) && word != strings.ToLower(word) && word != strings.ToUpper(word) {
+				word = `"` + word + `"`
+			}
+			result.WriteString(word)
+			i = end - 1
+		default:
+			result.WriteRune(char)
+		}
+	}
+	return result.String()
+}
+
+// postgresWord tells whether char can start a word, numbers are read as
+// words too so that 1e5 or $1 are never split.
+func postgresWord(char rune) bool {
+	return char == '_' || unicode.IsLetter(char) || unicode.IsDigit(char)
+}
+
+// postgresExec runs a statement that needs no result through postgresQuery.
+func postgresExec(session *TypeSession, query string) error {
+	_, err := postgresStatement(session, func() (sql.Result, error) {
+		return session.Querier().ExecContext(session.Context(), postgresQuery(query))
+	})
+	return err
+}
+
+// postgresStatement runs fn inside a savepoint when the session is in a
+// transaction: on PostgreSQL a failed statement aborts the whole transaction,
+// while the other engines only discard the statement itself. Nested
+// statements get a savepoint of their own.
+func postgresStatement[T any](session *TypeSession, fn func() (T, error)) (T, error) {
+	if !session.InTx() {
+		return fn()
+	}
+	ctx := context.WithoutCancel(session.Context())
+	session.savepoints++
+	defer func() { session.savepoints-- }()
+	savepoint := fmt.Sprintf("ejaStatement%d", session.savepoints)
+	if _, err := session.Querier().ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		var empty T
+		return empty, err
+	}
+	result, err := fn()
+	if err != nil {
+		session.Querier().ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+savepoint)
+	}
+	session.Querier().ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint)
+	return result, err
+}
+
+func (engine *postgresEngine) Run(session *TypeSession, query string, args ...any) (TypeRun, error) {
+	return postgresStatement(session, func() (TypeRun, error) {
+		return engine.run(session, query, args...)
+	})
+}
+
+func (engine *postgresEngine) run(session *TypeSession, query string, args ...any) (TypeRun, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	if strings.HasPrefix(strings.ToUpper(query), "INSERT") && !strings.Contains(strings.ToUpper(query), "RETURNING") {
+		result, err := postgresStatement(session, func() (TypeRun, error) {
+			return engine.insert(session, query+" RETURNING ejaId", args...)
+		})
+		// tables without ejaId are inserted again without asking for it
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Code != "42703" || pqErr.Message != postgresIdMissing {
+			return result, err
+		}
+	}
+
+	result, err := session.Querier().ExecContext(session.Context(), postgresQuery(query), args...)
+	if err != nil {
+		return TypeRun{}, err
+	}
+	changes, _ := result.RowsAffected()
+	return TypeRun{Changes: changes}, nil
+}
+
+func (engine *postgresEngine) insert(session *TypeSession, query string, args ...any) (TypeRun, error) {
+	var result TypeRun
+	rows, err := session.Querier().QueryContext(session.Context(), postgresQuery(query), args...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&result.LastId); err != nil {
+			return result, err
+		}
+		result.Changes++
+	}
+	return result, rows.Err()
+}
+
+func (engine *postgresEngine) Value(session *TypeSession, query string, args ...any) (string, error) {
+	return postgresStatement(session, func() (string, error) {
+		return engine.TypeEngineSql.Value(session, postgresQuery(query), args...)
+	})
+}
+
+func (engine *postgresEngine) Row(session *TypeSession, query string, args ...any) (TypeRow, error) {
+	row, err := postgresStatement(session, func() (TypeRow, error) {
+		return engine.TypeEngineSql.Row(session, postgresQuery(query), args...)
+	})
+	return row, err
+}
+
+func (engine *postgresEngine) Rows(session *TypeSession, query string, args ...any) (TypeRows, error) {
+	return postgresStatement(session, func() (TypeRows, error) {
+		return engine.TypeEngineSql.Rows(session, postgresQuery(query), args...)
+	})
+}
+
+func (engine *postgresEngine) Cols(session *TypeSession, query string, args ...any) ([]string, error) {
+	return postgresStatement(session, func() ([]string, error) {
+		return engine.TypeEngineSql.Cols(session, postgresQuery(query), args...)
+	})
+}
+
+func (engine *postgresEngine) Query(session *TypeSession, query string, args ...any) (TypeResult, error) {
+	return postgresStatement(session, func() (TypeResult, error) {
+		return engine.TypeEngineSql.Query(session, postgresQuery(query), args...)
+	})
+}
+
+func (engine *postgresEngine) TableExists(session *TypeSession, name string) (bool, error) {
+	if err := engine.TableNameIsValid(name); err != nil {
+		return false, err
+	}
+	var exists bool
+	err := session.Querier().QueryRowContext(session.Context(), `SELECT to_regclass(quote_ident($1)) IS NOT NULL`, name).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+func (engine *postgresEngine) FieldExists(session *TypeSession, tableName, fieldName string) (bool, error) {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return false, err
+	}
+	if err := engine.FieldNameIsValid(fieldName); err != nil {
+		return false, err
+	}
+
+	query := `SELECT COUNT(*) FROM pg_attribute WHERE attrelid = to_regclass(quote_ident($1)) AND attname = $2 AND attnum > 0 AND NOT attisdropped`
+
+	var count int
+	err := session.Querier().QueryRowContext(session.Context(), query, tableName, fieldName).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (engine *postgresEngine) TableAdd(tableName string, temporary bool) []string {
+	return []string{
+		fmt.Sprintf("CREATE %s TABLE %s (ejaId SERIAL PRIMARY KEY, ejaOwner INTEGER, ejaLog TIMESTAMP)", engineTemporary(temporary), tableName),
+		fmt.Sprintf("CREATE TRIGGER ejaIdDefault BEFORE INSERT ON %s FOR EACH ROW EXECUTE PROCEDURE ejaIdDefault()", tableName),
+	}
+}
+
+func (engine *postgresEngine) FieldType(fieldType string) string {
+	switch fieldType {
+	case "json":
+		return "JSONB"
+	case "money":
+		return "BIGINT"
+	}
+	switch sqlType := FieldType(fieldType); sqlType {
+	case "DOUBLE":
+		return "DOUBLE PRECISION"
+	case "DATETIME":
+		return "TIMESTAMP"
+	default:
+		return sqlType
+	}
+}
+
+func (engine *postgresEngine) TableNameIsValid(name string) error {
+	if !postgresValidTableNameRegex.MatchString(name) {
+		return errors.New("table name is not valid")
+	}
+	return nil
+}
+
+func (engine *postgresEngine) FieldNameIsValid(name string) error {
+	if !postgresValidFieldNameRegex.MatchString(name) {
+		return errors.New("field name is not valid")
+	}
+	return nil
+}
+
+func (engine *postgresEngine) FtsAdd(session *TypeSession, tableName, columnName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	if err := engine.FieldNameIsValid(columnName); err != nil {
+		return err
+	}
+
+	return postgresExec(session, fmt.Sprintf(
+		"CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)",
+		postgresFtsIndex(session, tableName, columnName), tableName, postgresFtsVector(columnName),
+	))
+}
+
+func (engine *postgresEngine) FtsDel(session *TypeSession, tableName, columnName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	if err := engine.FieldNameIsValid(columnName); err != nil {
+		return err
+	}
+
+	return postgresExec(session, "DROP INDEX IF EXISTS "+postgresFtsIndex(session, tableName, columnName))
+}
+
+// postgresFtsIndex keeps the index name within the 63 characters identifier limit.
+func postgresFtsIndex(session *TypeSession, tableName, columnName string) string {
+	indexName := fmt.Sprintf("ejaFTS_%s_%s", tableName, columnName)
+	if len(indexName) > 63 {
+		indexName = "ejaFTS_" + session.Sha256(indexName)[:32]
+	}
+	return indexName
+}
+
+func (engine *postgresEngine) FieldDel(session *TypeSession, tableName string, fieldName string) error {
+	return postgresExec(session, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, fieldName))
+}
+
+func (engine *postgresEngine) FieldRename(session *TypeSession, tableName string, fieldName string, newName string) error {
+	return postgresExec(session, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", tableName, fieldName, newName))
+}
+
+// FieldRetype converts the current values, empty strings become NULL when
+// the new type is not textual.
+func (engine *postgresEngine) FieldRetype(session *TypeSession, tableName string, fieldName string, sqlType string) error {
+	using := fmt.Sprintf("CAST(%s AS TEXT)", fieldName)
+	if sqlType != "TEXT" {
+		using = fmt.Sprintf("CAST(NULLIF(TRIM(CAST(%s AS TEXT)), '') AS %s)", fieldName, sqlType)
+	}
+	return postgresExec(session, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s", tableName, fieldName, sqlType, using))
+}
+
+func (engine *postgresEngine) IndexAdd(session *TypeSession, tableName string, indexName string, fieldNames []string, unique bool) error {
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	return postgresExec(session, fmt.Sprintf("CREATE %s IF NOT EXISTS %s ON %s (%s)", kind, indexName, tableName, strings.Join(fieldNames, ", ")))
+}
+
+func (engine *postgresEngine) IndexDel(session *TypeSession, tableName string, indexName string) error {
+	return postgresExec(session, "DROP INDEX IF EXISTS "+indexName)
+}
+
+func (engine *postgresEngine) SearchFts(tableName string, fieldName string) string {
+	return fmt.Sprintf(` AND %s @@ plainto_tsquery('simple', ?) `, postgresFtsVector(fieldName))
+}
+
+func (engine *postgresEngine) SearchLike(fieldName string) string {
+	return fmt.Sprintf(" AND CAST(%s AS TEXT) ILIKE ? ", fieldName)
+}
+
+func (engine *postgresEngine) SearchMultiple(fieldName string) string {
+	return fmt.Sprintf(` AND %s LIKE '%%"' || CAST(? AS TEXT) || '"%%' `, fieldName)
+}
+
+func postgresFtsVector(columnName string) string {
+	return fmt.Sprintf("to_tsvector('simple', COALESCE(%s, ''))", columnName)
+}
+
+func (engine *postgresEngine) GeoPoint(fieldName string) (string, string) {
+	return fmt.Sprintf("CAST(NULLIF(split_part(%s, ',', 1), '') AS DOUBLE PRECISION)", fieldName),
+		fmt.Sprintf("CAST(NULLIF(split_part(%s, ',', 2), '') AS DOUBLE PRECISION)", fieldName)
+}
+
+func (engine *postgresEngine) JsonPath(fieldName string, path string, numeric bool) string {
+	parts := strings.Join(jsonPathParts(path), ",")
+	if numeric {
+		return fmt.Sprintf("CASE WHEN jsonb_typeof(CAST(%s AS JSONB) #> '{%s}') = 'number' THEN CAST(CAST(%s AS JSONB) #>> '{%s}' AS DOUBLE PRECISION) END", fieldName, parts, fieldName, parts)
+	}
+	return fmt.Sprintf("(CAST(%s AS JSONB) #>> '{%s}')", fieldName, parts)
+}
+
+func (engine *postgresEngine) Formula(function string, args []string) string {
+	switch function {
+	case "round":
+		args = append([]string{fmt.Sprintf("CAST(%s AS NUMERIC)", args[0])}, args[1:]...)
+	case "years":
+		return fmt.Sprintf("CAST(date_part('year', age(CURRENT_DATE, CAST(%s AS DATE))) AS INTEGER)", args[0])
+	case "days":
+		return fmt.Sprintf("(CAST(%s AS DATE) - CAST(%s AS DATE))", formulaDefault(args, 1, "CURRENT_DATE"), args[0])
+	}
+	return engine.TypeEngineSql.Formula(function, args)
+}
+
+func (engine *postgresEngine) WindowCount(session *TypeSession) bool {
+	return true
+}
+
+// Integer reads expr as a number, postgres does not compare the text columns
+// of the sqlMatrix fields with the integer ids they hold.
+func (engine *postgresEngine) Integer(expr string) string {
+	return fmt.Sprintf("(CASE WHEN CAST(%s AS TEXT) ~ '^-?[0-9]+$' THEN CAST(CAST(%s AS TEXT) AS BIGINT) END)", expr, expr)
+}
+
+// IdSync moves the ejaId sequence of tableName past the ids inserted
+// explicitly, which the sequence does not see.
+func (engine *postgresEngine) IdSync(session *TypeSession, tableName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	_, err := engine.Value(session, fmt.Sprintf("SELECT setval(pg_get_serial_sequence(?, 'ejaId'), COALESCE(MAX(ejaId), 0) + 1, false) FROM %s", tableName), `"`+tableName+`"`)
+	return err
+}
@@ -0,0 +1,30 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import "testing"
+
+// TestPostgresQuery tests the placeholders and identifiers rewriting of the postgres engine
+func TestPostgresQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT name FROM test WHERE a=? AND b=?", "SELECT name FROM test WHERE a=$1 AND b=$2"},
+		{"SELECT ejaId FROM ejaModules WHERE name=?", `SELECT "ejaId" FROM "ejaModules" WHERE name=$1`},
+		{"SELECT lf.ejaId FROM ejaPermissions AS lf", `SELECT lf."ejaId" FROM "ejaPermissions" AS lf`},
+		{"SELECT * FROM test WHERE a='?' AND b=?", "SELECT * FROM test WHERE a='?' AND b=$1"},
+		{"SELECT * FROM test WHERE a='it''s ?' AND b=?", "SELECT * FROM test WHERE a='it''s ?' AND b=$1"},
+		{"SELECT * FROM test WHERE a='ejaId' AND b=?", "SELECT * FROM test WHERE a='ejaId' AND b=$1"},
+		{`SELECT "ejaId", "x?" FROM test WHERE a=?`, `SELECT "ejaId", "x?" FROM test WHERE a=$1`},
+		{"SELECT COUNT(*) FROM test WHERE a > 1e5 AND b = ?", "SELECT COUNT(*) FROM test WHERE a > 1e5 AND b = $1"},
+		{"SELECT * FROM test WHERE a LIKE '%?", "SELECT * FROM test WHERE a LIKE '%?"},
+		{"SELECT CAST(ejaLog AS TEXT) FROM ejaAudit_2 WHERE recordId IN (?,?,?)", `SELECT CAST("ejaLog" AS TEXT) FROM "ejaAudit_2" WHERE "recordId" IN ($1,$2,$3)`},
+		{"SELECT città FROM test WHERE Città=?", `SELECT città FROM test WHERE "Città"=$1`},
+	}
+	for _, test := range tests {
+		if got := postgresQuery(test.query); got != test.want {
+			t.Errorf("postgresQuery(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
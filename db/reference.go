@@ -0,0 +1,122 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TypeReference is the configuration of a reference field, read from its
+// value as the target module and the field shown as label, like
+// customers.name. The column holds the ejaId of the target record.
+type TypeReference struct {
+	Module string
+	Field  string
+}
+
+// ReferenceField reads the configuration stored in the value of a reference field.
+func ReferenceField(value string) (reference TypeReference, ok bool) {
+	module, field, found := strings.Cut(strings.TrimSpace(value), ".")
+	if !found || module == "" || field == "" {
+		return reference, false
+	}
+	return TypeReference{Module: module, Field: field}, true
+}
+
+// ReferenceCheck tells whether value can be used as the configuration of a
+// reference field, before it is saved.
+func (session *TypeSession) ReferenceCheck(value string) error {
+	reference, ok := ReferenceField(value)
+	if !ok {
+		return errors.New("reference must be module.field")
+	}
+	return session.referenceValid(reference)
+}
+
+func (session *TypeSession) referenceValid(reference TypeReference) error {
+	if session.ModuleGetIdByName(reference.Module) < 1 {
+		return errors.New("reference module not found")
+	}
+	if err := session.TableNameIsValid(reference.Module); err != nil {
+		return err
+	}
+	if err := session.FieldNameIsValid(reference.Field); err != nil {
+		return err
+	}
+	if check, err := session.FieldExists(reference.Module, reference.Field); err != nil || !check {
+		return errors.New("reference field not found")
+	}
+	return nil
+}
+
+// referenceFrom returns the FROM and WHERE part of the queries on the target
+// records ownerId can read, or an empty string when the reference is not valid.
+func (session *TypeSession) referenceFrom(ownerId int64, reference TypeReference) string {
+	if session.referenceValid(reference) != nil {
+		return ""
+	}
+	moduleId := session.ModuleGetIdByName(reference.Module)
+	return fmt.Sprintf(" FROM %s WHERE ejaOwner IN (%s) %s", reference.Module, session.NumbersToCsv(session.Owners(ownerId, moduleId)), session.trashFilter(reference.Module, false))
+}
+
+// ReferenceOptions returns the target records ownerId can read, sorted by label.
+func (session *TypeSession) ReferenceOptions(ownerId int64, value string) []TypeSelect {
+	reference, ok := ReferenceField(value)
+	if !ok {
+		return nil
+	}
+	from := session.referenceFrom(ownerId, reference)
+	if from == "" {
+		return nil
+	}
+	return session.SelectSqlToRows(fmt.Sprintf("SELECT ejaId, %s%s ORDER BY %s", reference.Field, from, reference.Field))
+}
+
+// ReferenceLabel returns the label of the target record ejaId of the
+// reference field fieldName, ok is false when ownerId cannot read it.
+func (session *TypeSession) ReferenceLabel(ownerId int64, moduleId int64, fieldName string, ejaId int64) (string, bool) {
+	reference, ok := ReferenceField(session.fieldValueGet(moduleId, fieldName))
+	if !ok {
+		return "", false
+	}
+	from := session.referenceFrom(ownerId, reference)
+	if from == "" {
+		return "", false
+	}
+	rows, err := session.Rows(fmt.Sprintf("SELECT %s AS label%s AND ejaId=?", reference.Field, from), ejaId)
+	if err != nil || len(rows) == 0 {
+		return "", false
+	}
+	return rows[0]["label"], true
+}
+
+// referenceSearch returns the condition matching the records whose target
+// label is like the searched value, config is the value of the field.
+func (session *TypeSession) referenceSearch(engine TypeEngine, ownerId int64, fieldName string, config string) string {
+	reference, ok := ReferenceField(config)
+	if !ok {
+		return ""
+	}
+	from := session.referenceFrom(ownerId, reference)
+	if from == "" {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s IN (SELECT ejaId%s%s) ", fieldName, from, engine.SearchLike(reference.Field))
+}
+
+// referenceImport returns the ejaId of the record of module labeled label
+// when fieldName is a reference field of moduleId pointing to it, the id is
+// empty when no record has that label.
+func (session *TypeSession) referenceImport(moduleId int64, fieldName string, module string, label string) (string, bool) {
+	if session.FieldTypeGet(moduleId, fieldName) != "reference" {
+		return "", false
+	}
+	reference, ok := ReferenceField(session.fieldValueGet(moduleId, fieldName))
+	if !ok || reference.Module != module || session.referenceValid(reference) != nil {
+		return "", false
+	}
+	id, _ := session.Value(fmt.Sprintf("SELECT ejaId FROM %s WHERE %s=? ORDER BY ejaId LIMIT 1", reference.Module, reference.Field), label)
+	return id, true
+}
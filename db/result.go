@@ -0,0 +1,244 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TypeColumn describes a result column, Type is the database type reduced to
+// integer, decimal, boolean, date, time, datetime, blob or text, or geo and
+// json when the module field is one.
+type TypeColumn struct {
+	Name         string
+	Type         string
+	DatabaseType string
+}
+
+// TypeCell is a single value in the same text form TypeRow uses, Null tells a
+// SQL NULL apart from an empty string.
+type TypeCell struct {
+	Text string
+	Null bool
+}
+
+// TypeResult keeps the columns in query order together with their types.
+type TypeResult struct {
+	Columns []TypeColumn
+	Rows    [][]TypeCell
+}
+
+// TypeRecord is a row with typed values: nil, int64, float64, bool, string,
+// a GeoJSON point or raw JSON.
+type TypeRecord map[string]any
+
+func (result TypeResult) Cols() []string {
+	cols := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		cols[i] = column.Name
+	}
+	return cols
+}
+
+// Map returns the i-th row as TypeRow, NULL values become empty strings.
+func (result TypeResult) Map(i int) TypeRow {
+	row := make(TypeRow, len(result.Columns))
+	for j, column := range result.Columns {
+		row[column.Name] = result.Rows[i][j].Text
+	}
+	return row
+}
+
+func (result TypeResult) Maps() (rows TypeRows) {
+	for i := range result.Rows {
+		rows = append(rows, result.Map(i))
+	}
+	return
+}
+
+func (result TypeResult) Record(i int) TypeRecord {
+	record := make(TypeRecord, len(result.Columns))
+	for j, column := range result.Columns {
+		record[column.Name] = result.Rows[i][j].Typed(column.Type)
+	}
+	return record
+}
+
+func (result TypeResult) Records() []TypeRecord {
+	records := make([]TypeRecord, len(result.Rows))
+	for i := range result.Rows {
+		records[i] = result.Record(i)
+	}
+	return records
+}
+
+// Typed converts the cell to the Go type matching cellType, geo values become
+// GeoJSON points and json ones are embedded as they are, values that do not
+// parse are returned as text.
+func (cell TypeCell) Typed(cellType string) any {
+	if cell.Null {
+		return nil
+	}
+	switch cellType {
+	case "integer":
+		if value, err := strconv.ParseInt(cell.Text, 10, 64); err == nil {
+			return value
+		}
+	case "decimal":
+		if value, err := strconv.ParseFloat(cell.Text, 64); err == nil {
+			return value
+		}
+	case "boolean":
+		if value, err := strconv.ParseBool(cell.Text); err == nil {
+			return value
+		}
+		if value, err := strconv.ParseInt(cell.Text, 10, 64); err == nil {
+			return value != 0
+		}
+	case "geo":
+		if point := geoJson(cell.Text); point != nil {
+			return point
+		}
+	case "json":
+		if json.Valid([]byte(cell.Text)) {
+			return json.RawMessage(cell.Text)
+		}
+	}
+	return cell.Text
+}
+
+func (session *TypeSession) Query(query string, args ...any) (TypeResult, error) {
+	return session.QueryContext(session.Context(), query, args...)
+}
+
+func (session *TypeSession) QueryContext(ctx context.Context, query string, args ...any) (result TypeResult, err error) {
+	engine, err := session.engine()
+	if err == nil {
+		bound, cancel := session.statement(ctx)
+		defer cancel()
+		result, err = engine.Query(bound, query, args...)
+	}
+
+	session.log(query, args, err)
+	return
+}
+
+// GetRecord is like Get but returns typed values, field types from ejaFields
+// take precedence over the database ones.
+func (session *TypeSession) GetRecord(ownerId int64, moduleId int64, ejaId int64) (TypeRecord, error) {
+	moduleName := session.ModuleGetNameById(moduleId)
+	if err := session.TableNameIsValid(moduleName); err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT * FROM %s WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, session.OwnersCsv(ownerId, moduleId))
+	result, err := session.Query(query, ejaId)
+	if err != nil || len(result.Rows) == 0 {
+		return nil, err
+	}
+	session.resultFieldTypes(&result, moduleId)
+	return result.Record(0), nil
+}
+
+// resultFieldTypes refines the column types with the module field definitions.
+func (session *TypeSession) resultFieldTypes(result *TypeResult, moduleId int64) {
+	rows, err := session.Rows("SELECT name, type FROM ejaFields WHERE ejaModuleId=?", moduleId)
+	if err != nil {
+		return
+	}
+	fieldTypes := make(map[string]string)
+	for _, row := range rows {
+		fieldTypes[row["name"]] = row["type"]
+	}
+	for i, column := range result.Columns {
+		if fieldType, ok := fieldTypes[column.Name]; ok {
+			result.Columns[i].Type = resultFieldType(fieldType)
+		}
+	}
+}
+
+func resultFieldType(fieldType string) string {
+	switch fieldType {
+	case "boolean", "integer", "decimal", "date", "time", "datetime", "geo", "json":
+		return fieldType
+	case "money":
+		return "integer"
+	default:
+		return "text"
+	}
+}
+
+func engineColumnType(databaseType string) string {
+	name := strings.ToUpper(databaseType)
+	switch {
+	case name == "BOOL" || name == "BOOLEAN":
+		return "boolean"
+	case strings.Contains(name, "INT") && name != "INTERVAL", strings.Contains(name, "SERIAL"):
+		return "integer"
+	case strings.Contains(name, "DOUBLE"), strings.Contains(name, "FLOAT"), strings.Contains(name, "REAL"), strings.Contains(name, "DECIMAL"), strings.Contains(name, "NUMERIC"):
+		return "decimal"
+	case name == "DATE":
+		return "date"
+	case name == "DATETIME", strings.HasPrefix(name, "TIMESTAMP"):
+		return "datetime"
+	case strings.HasPrefix(name, "TIME"):
+		return "time"
+	case strings.Contains(name, "BLOB"), strings.Contains(name, "BINARY"), name == "BYTEA":
+		return "blob"
+	default:
+		return "text"
+	}
+}
+
+// engineResult reads up to max rows (all of them when max is 0).
+func engineResult(rows *sql.Rows, max int) (TypeResult, error) {
+	var result TypeResult
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return result, err
+	}
+
+	result.Columns = make([]TypeColumn, len(columnTypes))
+	for i, columnType := range columnTypes {
+		result.Columns[i] = TypeColumn{
+			Name:         columnType.Name(),
+			Type:         engineColumnType(columnType.DatabaseTypeName()),
+			DatabaseType: columnType.DatabaseTypeName(),
+		}
+	}
+
+	values := make([]sql.RawBytes, len(columnTypes))
+	scanArgs := make([]any, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return TypeResult{}, err
+		}
+		row := make([]TypeCell, len(values))
+		for i, value := range values {
+			if value == nil {
+				row[i].Null = true
+			} else {
+				row[i].Text = string(value)
+			}
+		}
+		result.Rows = append(result.Rows, row)
+		if max > 0 && len(result.Rows) >= max {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return TypeResult{}, err
+	}
+
+	return result, nil
+}
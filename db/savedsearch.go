@@ -0,0 +1,138 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var ErrSearchNotPermitted = errors.New("ejaNotPermitted")
+
+// TypeSavedSearch is a named search stored in ejaSearches, shared with the
+// members of GroupId when it is set and shown in the module tree when pinned.
+type TypeSavedSearch struct {
+	Id       int64                   `json:"Id"`
+	Name     string                  `json:"Name"`
+	ModuleId int64                   `json:"ModuleId"`
+	GroupId  int64                   `json:"GroupId,omitempty"`
+	Pinned   bool                    `json:"Pinned,omitempty"`
+	Criteria TypeSavedSearchCriteria `json:"-"`
+}
+
+// TypeSavedSearchCriteria holds what is needed to run a saved search again,
+// the query is rebuilt on every run so it follows the user applying it.
+type TypeSavedSearchCriteria struct {
+	Values      map[string]string `json:"Values,omitempty"`
+	Filter      *TypeFilter       `json:"Filter,omitempty"`
+	SearchOrder map[string]string `json:"SearchOrder,omitempty"`
+	SearchLimit int64             `json:"SearchLimit,omitempty"`
+}
+
+// savedSearchFrom returns the condition selecting the saved searches ownerId
+// can apply, its own and the ones shared with its groups.
+func (session *TypeSession) savedSearchFrom(ownerId int64) string {
+	groupId := session.integerSql("ejaGroupId")
+	return fmt.Sprintf(" FROM ejaSearches WHERE (ejaOwner IN (%s) OR (%s > 0 AND %s IN (%s))) ",
+		session.OwnersCsv(ownerId, session.ModuleGetIdByName("ejaSearches")), groupId, groupId, session.UserGroupCsv(ownerId))
+}
+
+func (session *TypeSession) savedSearchRow(ownerId int64, row TypeRow) TypeSavedSearch {
+	search := TypeSavedSearch{
+		Id:       session.Number(row["ejaId"]),
+		Name:     row["name"],
+		ModuleId: session.Number(row["ejaModuleId"]),
+		GroupId:  session.Number(row["ejaGroupId"]),
+		Pinned:   session.Number(row["pinned"]) > 0,
+	}
+	json.Unmarshal([]byte(row["criteria"]), &search.Criteria)
+	return search
+}
+
+// SavedSearches returns the saved searches ownerId can apply on moduleId, or
+// on every module when moduleId is 0, only the pinned ones if pinned is true.
+func (session *TypeSession) SavedSearches(ownerId int64, moduleId int64, pinned bool) (result []TypeSavedSearch) {
+	if check, err := session.TableExists("ejaSearches"); err != nil || !check {
+		return
+	}
+	query := "SELECT *" + session.savedSearchFrom(ownerId)
+	var args []any
+	if moduleId > 0 {
+		query += " AND ejaModuleId=? "
+		args = append(args, moduleId)
+	}
+	if pinned {
+		query += " AND pinned > 0 "
+	}
+	rows, err := session.Rows(query+" ORDER BY name, ejaId", args...)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		result = append(result, session.savedSearchRow(ownerId, row))
+	}
+	return
+}
+
+// SavedSearchGet returns the saved search searchId when ownerId can apply it.
+func (session *TypeSession) SavedSearchGet(ownerId int64, searchId int64) (TypeSavedSearch, error) {
+	if check, err := session.TableExists("ejaSearches"); err != nil || !check {
+		return TypeSavedSearch{}, errors.New("ejaSearchNotFound")
+	}
+	row, err := session.Row("SELECT *"+session.savedSearchFrom(ownerId)+" AND ejaId=?", searchId)
+	if err != nil || len(row) == 0 {
+		return TypeSavedSearch{}, errors.New("ejaSearchNotFound")
+	}
+	return session.savedSearchRow(ownerId, row), nil
+}
+
+// SavedSearchCheck tells whether ownerId can keep a search on moduleId shared
+// with groupId: it must be allowed to search the module and, when groupId is
+// set, be a member of the group.
+func (session *TypeSession) SavedSearchCheck(ownerId int64, moduleId int64, groupId int64) error {
+	commands, err := session.Commands(ownerId, moduleId, "")
+	if err != nil || !session.CommandExists(commands, "search") {
+		return ErrSearchNotPermitted
+	}
+	if groupId > 0 && !slices.Contains(session.UserGroupList(ownerId), groupId) {
+		return ErrSearchNotPermitted
+	}
+	return nil
+}
+
+// SavedSearchSave stores the criteria under name for moduleId, replacing the
+// search with the same name ownerId already saved there.
+func (session *TypeSession) SavedSearchSave(ownerId int64, moduleId int64, name string, criteria TypeSavedSearchCriteria) (searchId int64, err error) {
+	if err = session.SavedSearchCheck(ownerId, moduleId, 0); err != nil {
+		return
+	}
+	data, err := json.Marshal(criteria)
+	if err != nil {
+		return
+	}
+	searchesId := session.ModuleGetIdByName("ejaSearches")
+	if searchesId < 1 {
+		return 0, errors.New("ejaSearchNotFound")
+	}
+	err = session.WithTx(func(session *TypeSession) error {
+		value, err := session.Value("SELECT ejaId FROM ejaSearches WHERE ejaOwner=? AND ejaModuleId=? AND name=? ORDER BY ejaId LIMIT 1", ownerId, moduleId, name)
+		if err != nil {
+			return err
+		}
+		if searchId = session.Number(value); searchId < 1 {
+			if searchId, err = session.New(ownerId, searchesId); err != nil {
+				return err
+			}
+			if err := session.Put(ownerId, searchesId, searchId, "name", name); err != nil {
+				return err
+			}
+			if err := session.Put(ownerId, searchesId, searchId, "ejaModuleId", moduleId); err != nil {
+				return err
+			}
+		}
+		return session.Put(ownerId, searchesId, searchId, "criteria", string(data))
+	})
+	return
+}
@@ -0,0 +1,173 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"errors"
+)
+
+// TypeSchemaDiff holds the steps needed to align a table column with a new
+// ejaFields definition, Field is the current column and Name the wanted one.
+// OldSqlType and NewSqlType are the column types of the engine in use.
+type TypeSchemaDiff struct {
+	Table      string
+	Field      string
+	Name       string
+	OldType    string
+	NewType    string
+	OldSqlType string
+	NewSqlType string
+	OldIndex   string
+	NewIndex   string
+	Add        bool
+	Drop       bool
+	Rename     bool
+	Retype     bool
+	textType   string
+}
+
+func (diff TypeSchemaDiff) Empty() bool {
+	return !diff.Add && !diff.Drop && !diff.Rename && !diff.Retype && (diff.OldType == "fts") == (diff.NewType == "fts") && diff.OldIndex == diff.NewIndex
+}
+
+// reindex is true when the field index has to be dropped and created again.
+func (diff TypeSchemaDiff) reindex() bool {
+	return diff.Rename || diff.Retype || diff.OldIndex != diff.NewIndex
+}
+
+// Destructive is true when applying the diff can lose data: dropping a column
+// or converting it to a type that cannot hold every text value.
+func (diff TypeSchemaDiff) Destructive() bool {
+	return diff.Drop || (diff.Retype && diff.NewSqlType != diff.textType)
+}
+
+// fieldHasColumn tells whether a field type is stored in a table column.
+func fieldHasColumn(fieldType string) bool {
+	return fieldType != "" && fieldType != "label" && fieldType != "sqlValue" && fieldType != "formula"
+}
+
+// SchemaDiff compares the stored definition of fieldId with the new name, type
+// and index, moduleId less than 1 keeps the stored module. An empty name and
+// type describe the removal of the field.
+func (session *TypeSession) SchemaDiff(fieldId int64, moduleId int64, name string, fieldType string, index string) (diff TypeSchemaDiff, err error) {
+	engine, err := session.engine()
+	if err != nil {
+		return
+	}
+
+	var old TypeRow
+	if fieldId > 0 {
+		if old, err = session.Row("SELECT * FROM ejaFields WHERE ejaId=?", fieldId); err != nil {
+			return
+		}
+	}
+	if moduleId < 1 {
+		moduleId = session.Number(old["ejaModuleId"])
+	}
+
+	diff.Table = session.ModuleGetNameById(moduleId)
+	if check, _ := session.TableExists(diff.Table); !check {
+		return TypeSchemaDiff{}, nil
+	}
+
+	oldColumn := false
+	if session.Number(old["ejaModuleId"]) == moduleId && fieldHasColumn(old["type"]) {
+		if oldColumn, err = session.FieldExists(diff.Table, old["name"]); err != nil {
+			return
+		}
+	}
+	newColumn := fieldHasColumn(fieldType) && name != ""
+
+	diff.Field, diff.Name, diff.NewType = name, name, fieldType
+	diff.textType = engine.FieldType("text")
+	if newColumn {
+		diff.NewSqlType, diff.NewIndex = engine.FieldType(fieldType), FieldIndex(index)
+	}
+	if oldColumn {
+		diff.Field, diff.OldType, diff.OldIndex = old["name"], old["type"], FieldIndex(old["sqlIndex"])
+		diff.OldSqlType = engine.FieldType(diff.OldType)
+	}
+
+	switch {
+	case oldColumn && !newColumn:
+		diff.Drop = true
+	case !oldColumn && newColumn:
+		check, err := session.FieldExists(diff.Table, name)
+		if err != nil {
+			return TypeSchemaDiff{}, err
+		}
+		diff.Add = !check
+		if check {
+			diff.OldType, diff.OldSqlType = diff.NewType, diff.NewSqlType
+		}
+	case oldColumn && newColumn:
+		diff.Rename = diff.Field != diff.Name
+		diff.Retype = diff.OldSqlType != diff.NewSqlType
+	}
+
+	return
+}
+
+// SchemaApply runs the DDL described by diff, on SQLite a type change or a
+// removal rebuilds the table keeping its data.
+func (session *TypeSession) SchemaApply(diff TypeSchemaDiff) error {
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
+
+	if diff.Add {
+		if err := session.FieldAdd(diff.Table, diff.Name, diff.NewType); err != nil {
+			return err
+		}
+	}
+
+	if diff.OldIndex != "" && (diff.Drop || diff.reindex()) {
+		if err := session.IndexDel(TypeIndex{Table: diff.Table, Fields: []string{diff.Field}}); err != nil {
+			return err
+		}
+	}
+
+	if diff.OldType == "fts" && (diff.Drop || diff.Rename || diff.NewType != "fts") {
+		if err := engine.FtsDel(session, diff.Table, diff.Field); err != nil {
+			return err
+		}
+	}
+
+	if diff.Drop {
+		return engine.FieldDel(session, diff.Table, diff.Field)
+	}
+
+	if diff.Rename {
+		if err := session.FieldNameIsValid(diff.Name); err != nil {
+			return err
+		}
+		if check, err := session.FieldExists(diff.Table, diff.Name); err != nil || check {
+			if err == nil {
+				err = errors.New("field already exists")
+			}
+			return err
+		}
+		if err := engine.FieldRename(session, diff.Table, diff.Field, diff.Name); err != nil {
+			return err
+		}
+	}
+
+	if diff.Retype {
+		if err := engine.FieldRetype(session, diff.Table, diff.Name, diff.NewSqlType); err != nil {
+			return err
+		}
+	}
+
+	if diff.NewType == "fts" && !diff.Add && (diff.Rename || diff.OldType != "fts") {
+		if err := engine.FtsAdd(session, diff.Table, diff.Name); err != nil {
+			return err
+		}
+	}
+
+	if diff.NewIndex != "" && (diff.Add || diff.reindex()) {
+		return session.IndexAdd(TypeIndex{Table: diff.Table, Fields: []string{diff.Name}, Unique: diff.NewIndex == "unique"})
+	}
+
+	return nil
+}
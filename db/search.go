@@ -6,46 +6,121 @@ import (
 	"fmt"
 	"log/slog"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
 type TypeSearchColumn map[string]map[string]any
 
 func (session *TypeSession) SearchMatrix(ownerId int64, moduleId int64, query string, queryArgs []any) (resultRows TypeRows, resultCols []string, resultLabels map[string]string, err error) {
-	var sqlResult TypeRows
-	var queryHead TypeSearchColumn
-	resultLabels = make(map[string]string)
+	result, resultLabels, err := session.SearchResult(ownerId, moduleId, query, queryArgs)
+	if err != nil {
+		return
+	}
+	return result.Maps(), result.Cols(), resultLabels, nil
+}
 
-	queryHead, query, err = session.searchHeader(query, moduleId)
+// SearchResult runs the list query once and returns the formatted rows keeping
+// column order, field types and NULL values.
+func (session *TypeSession) SearchResult(ownerId int64, moduleId int64, query string, queryArgs []any) (result TypeResult, resultLabels map[string]string, err error) {
+	queryHead, query, err := session.searchHeader(ownerId, query, moduleId)
 	if err != nil {
 		return
 	}
 
-	sqlResult, err = session.Rows(query, queryArgs...)
+	result, err = session.Query(query, queryArgs...)
 	if err != nil {
 		return
 	}
 
-	resultCols, err = session.Cols(query, queryArgs...)
+	return result, session.searchFormat(ownerId, queryHead, &result), nil
+}
+
+// SearchPage returns one page of the list query together with the number of
+// rows of the whole query, both from a single round trip when the engine
+// supports window functions.
+func (session *TypeSession) SearchPage(ownerId int64, moduleId int64, query string, order string, limit int64, offset int64, queryArgs []any) (result TypeResult, resultLabels map[string]string, count int64, err error) {
+	engine, err := session.engine()
 	if err != nil {
 		return
 	}
 
-	for _, val := range resultCols {
-		resultLabels[val] = session.Translate(val, ownerId)
+	queryHead, queryPage, err := session.searchHeader(ownerId, query, moduleId)
+	if err != nil {
+		return
 	}
 
-	for _, row := range sqlResult {
-		resultRows = append(resultRows, session.searchRow(ownerId, queryHead, row))
+	window := false
+	if head, found := strings.CutPrefix(strings.TrimSpace(queryPage), "SELECT "); found && !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(head)), "DISTINCT") && engine.WindowCount(session) {
+		window = true
+		queryPage = "SELECT COUNT(*) OVER() AS ejaSearchCount, " + head
 	}
 
-	return
+	result, err = session.Query(queryPage+" "+session.SearchQueryOrderAndLimit(order, limit, offset), queryArgs...)
+	if err != nil {
+		return
+	}
+
+	if window && len(result.Columns) > 0 {
+		if len(result.Rows) > 0 {
+			count = session.Number(result.Rows[0][0].Text)
+		}
+		result.Columns = result.Columns[1:]
+		for i := range result.Rows {
+			result.Rows[i] = result.Rows[i][1:]
+		}
+	}
+	if !window || (len(result.Rows) == 0 && offset > 0) {
+		count = session.SearchCount(query, queryArgs)
+	}
+
+	return result, session.searchFormat(ownerId, queryHead, &result), count, nil
+}
+
+// searchFormat replaces the raw values with their labels and returns the translated column names.
+func (session *TypeSession) searchFormat(ownerId int64, queryHead TypeSearchColumn, result *TypeResult) map[string]string {
+	resultLabels := make(map[string]string)
+
+	for i, column := range result.Columns {
+		resultLabels[column.Name] = session.Translate(column.Name, ownerId)
+		if head, ok := queryHead[column.Name]; ok {
+			result.Columns[i].Type = resultFieldType(session.String(head["type"]))
+			if head["type"] == "money" {
+				head["language"] = session.UserLanguage(ownerId)
+			}
+		}
+	}
+
+	for i := range result.Rows {
+		row := session.searchRow(ownerId, queryHead, result.Map(i))
+		for j, column := range result.Columns {
+			if !result.Rows[i][j].Null {
+				result.Rows[i][j].Text = row[column.Name]
+			}
+		}
+	}
+
+	return resultLabels
 }
 
 func (session *TypeSession) SearchQuery(ownerId int64, tableName string, values map[string]string) (string, []any, error) {
+	return session.searchQuery(ownerId, tableName, values, false)
+}
+
+// SearchTrashQuery is like SearchQuery but only matches the trashed records.
+func (session *TypeSession) SearchTrashQuery(ownerId int64, tableName string, values map[string]string) (string, []any, error) {
+	return session.searchQuery(ownerId, tableName, values, true)
+}
+
+func (session *TypeSession) searchQuery(ownerId int64, tableName string, values map[string]string, trashed bool) (string, []any, error) {
 	var sql []string
 	var args []any
 
+	engine, err := session.engine()
+	if err != nil {
+		return "", nil, err
+	}
+
 	moduleId := session.ModuleGetIdByName(tableName)
 	sqlType := make(map[string]string)
 
@@ -55,17 +130,47 @@ func (session *TypeSession) SearchQuery(ownerId int64, tableName string, values
 	if err != nil {
 		return "", nil, err
 	}
+	formulas := make(map[string]string)
+	fieldConfig := make(map[string]string)
 	for _, row := range rows {
+		sqlType[row["name"]] = row["type"]
+		fieldConfig[row["name"]] = row["value"]
+		if row["type"] == "formula" {
+			formula, err := session.FormulaSql(moduleId, row["value"])
+			if err != nil {
+				slog.Warn("formula", "module", tableName, "field", row["name"], "error", err)
+				continue
+			}
+			formulas[row["name"]] = "(" + formula + ")"
+		}
 		if session.Number(row["powerList"]) > 0 {
 			sql = append(sql, ",")
+			if formula, ok := formulas[row["name"]]; ok {
+				sql = append(sql, formula+" AS ")
+			}
 			sql = append(sql, row["name"])
 		}
-		sqlType[row["name"]] = row["type"]
 	}
 
+	selectSize := len(sql)
+	distance, distanceKey := "", ""
 	sql = append(sql, fmt.Sprintf(" FROM %s WHERE ejaOwner IN ("+session.NumbersToCsv(session.Owners(ownerId, moduleId))+") ", tableName))
+	sql = append(sql, session.trashFilter(tableName, trashed))
 
 	for keyRaw, val := range values {
+		if key, path, found := strings.Cut(keyRaw, "."); found && strings.HasPrefix(path, "$") && val != "" {
+			if sqlType[key] != "json" || session.FieldNameIsValid(key) != nil {
+				continue
+			}
+			condition, arg, ok := jsonSearch(engine, key, path, val)
+			if !ok {
+				slog.Warn("json search", "module", tableName, "field", key, "path", path)
+				continue
+			}
+			sql = append(sql, condition)
+			args = append(args, arg)
+			continue
+		}
 		keyMode := ""
 		keySplit := strings.Split(keyRaw, ".")
 		key := keySplit[0]
@@ -80,6 +185,13 @@ func (session *TypeSession) SearchQuery(ownerId int64, tableName string, values
 			switch sqlTypeThis {
 			case "boolean":
 				sqlAnd = fmt.Sprintf(" AND %s = ? ", key)
+			case "money":
+				amount, ok := MoneyField(fieldConfig[key]).Parse(val, session.UserLanguage(ownerId))
+				if !ok {
+					continue
+				}
+				arg = strconv.FormatInt(amount, 10)
+				fallthrough
 			case "integer", "decimal":
 				switch keyMode {
 				case "start":
@@ -98,21 +210,43 @@ func (session *TypeSession) SearchQuery(ownerId int64, tableName string, values
 				default:
 					sqlAnd = fmt.Sprintf(" AND %s = ? ", key)
 				}
-			case "multiple", "sqlMultiple":
-				sqlAnd = fmt.Sprintf(` AND %s LIKE '%%"' || ? || '"%%' `, key)
-			case "fts":
-				if session.Engine == "sqlite" {
-					sqlAnd = fmt.Sprintf(
-						" AND rowid IN (SELECT rowid FROM ejaFTS_%s_%s WHERE %s MATCH ?) ",
-						tableName, key, key,
-					)
+			case "formula":
+				formula, ok := formulas[key]
+				if !ok {
+					continue
+				}
+				switch keyMode {
+				case "start":
+					sqlAnd = fmt.Sprintf(" AND %s >= %s ", formula, searchFormulaBound(val))
+				case "stop":
+					sqlAnd = fmt.Sprintf(" AND %s <= %s ", formula, searchFormulaBound(val))
+				default:
+					sqlAnd = engine.SearchLike(searchFormulaText(engine, formula))
+				}
+			case "geo":
+				if keyMode == "near" || keyMode == "box" {
+					condition, keyDistance, ok := geoSearch(engine, key, keyMode, val)
+					if !ok {
+						slog.Warn("geo search", "module", tableName, "field", key, "mode", keyMode, "value", val)
+						continue
+					}
+					sql = append(sql, condition)
+					if keyDistance != "" && (distanceKey == "" || key < distanceKey) {
+						distance, distanceKey = keyDistance, key
+					}
+					continue
 				}
-				if session.Engine == "mysql" {
-					sqlAnd = fmt.Sprintf(` AND MATCH(%s) AGAINST(? IN NATURAL LANGUAGE MODE) `, key)
+			case "reference":
+				if sqlAnd = session.referenceSearch(engine, ownerId, key, fieldConfig[key]); sqlAnd == "" {
+					continue
 				}
+			case "multiple", "sqlMultiple":
+				sqlAnd = engine.SearchMultiple(key)
+			case "fts":
+				sqlAnd = engine.SearchFts(tableName, key)
 			}
 			if sqlAnd == "" {
-				sqlAnd = fmt.Sprintf(" AND %s LIKE ? ", key)
+				sqlAnd = engine.SearchLike(key)
 			}
 			if arg == "" {
 				arg = val
@@ -124,6 +258,9 @@ func (session *TypeSession) SearchQuery(ownerId int64, tableName string, values
 			}
 		}
 	}
+	if distance != "" {
+		sql = append(sql[:selectSize], append([]string{", " + distance + " AS " + SearchDistance}, sql[selectSize:]...)...)
+	}
 	return strings.Join(sql, ""), args, nil
 }
 
@@ -135,7 +272,7 @@ func (session *TypeSession) SearchCount(query string, args []any) int64 {
 	}
 }
 
-func (session *TypeSession) searchHeader(query string, moduleId int64) (TypeSearchColumn, string, error) {
+func (session *TypeSession) searchHeader(ownerId int64, query string, moduleId int64) (TypeSearchColumn, string, error) {
 	colValues := make(TypeSearchColumn)
 
 	rows, err := session.Rows("SELECT * FROM ejaFields WHERE ejaModuleId=? AND powerList>0 ORDER BY powerList", moduleId)
@@ -155,8 +292,14 @@ func (session *TypeSession) searchHeader(query string, moduleId int64) (TypeSear
 			colValues[rowName]["value"] = session.SelectToRows(field["value"])
 		case "sqlMatrix", "sqlMultiple":
 			colValues[rowName]["value"] = session.SelectSqlToRows(field["value"])
+		case "reference":
+			colValues[rowName]["value"] = session.ReferenceOptions(ownerId, field["value"])
 		case "sqlValue", "sqlHidden":
 			query = strings.Replace(query, field["name"], fmt.Sprintf("(%s) AS %s", field["value"], field["name"]), 1)
+		case "image":
+			colValues[rowName]["module"] = moduleId
+		case "money":
+			colValues[rowName]["money"] = MoneyField(field["value"])
 		}
 
 		colValues[field["name"]]["translation"] = 0
@@ -185,6 +328,23 @@ func (session *TypeSession) searchRow(ownerId int64, queryHead TypeSearchColumn,
 			}
 			filteredRow[colName] = value
 		}
+		if queryHead[colName]["type"] == "file" {
+			if file, ok := FileParse(row[colName]); ok {
+				filteredRow[colName] = file.Name
+			}
+		}
+		if money, ok := queryHead[colName]["money"].(TypeMoney); ok {
+			if amount, err := strconv.ParseInt(row[colName], 10, 64); err == nil {
+				filteredRow[colName] = money.Format(amount, session.String(queryHead[colName]["language"]))
+			}
+		}
+		if queryHead[colName]["type"] == "image" {
+			if _, ok := ImageParse(row[colName]); ok {
+				filteredRow[colName] = FileUrl(session.Number(queryHead[colName]["module"]), session.Number(row["ejaId"]), colName, true)
+			} else {
+				filteredRow[colName] = ""
+			}
+		}
 		if len(row[colName]) >= 19 {
 			switch queryHead[colName]["type"] {
 			case "datetime":
@@ -204,13 +364,17 @@ func (session *TypeSession) searchRow(ownerId int64, queryHead TypeSearchColumn,
 }
 
 func (session *TypeSession) SearchQueryOrderAndLimit(order string, limit int64, offset int64) string {
+	sqlLimit := fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+	if engine, err := session.engine(); err == nil {
+		sqlLimit = engine.Limit(limit, offset)
+	}
 	pattern := `^\s*(\w+\s+(ASC|DESC)\s*,\s*)*\w+\s+(ASC|DESC)\s*$`
 	regexpPattern := regexp.MustCompile(pattern)
 	if !regexpPattern.MatchString(order) {
 		slog.Warn("order by is not regex compatible", "order", order)
-		return fmt.Sprintf("LIMIT %d OFFSET %d", limit, offset)
+		return sqlLimit
 	}
-	return fmt.Sprintf("ORDER BY %s LIMIT %d OFFSET %d", order, limit, offset)
+	return fmt.Sprintf("ORDER BY %s %s", order, sqlLimit)
 }
 
 func (session *TypeSession) SearchQueryLinks(ownerId, srcModuleId, srcFieldId, dstModuleId int64) string {
@@ -232,3 +396,18 @@ func (session *TypeSession) AutoSearch(moduleId int64) (check bool) {
 	}
 	return
 }
+
+// searchFormulaBound returns the placeholder of value compared with a formula,
+// expressions have no column type to convert the argument to.
+func searchFormulaBound(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return "(? * 1.0)"
+	}
+	return "?"
+}
+
+// searchFormulaText returns the formula as text, numeric expressions are
+// matched on their text.
+func searchFormulaText(engine TypeEngine, formula string) string {
+	return engine.Formula("concat", []string{formula})
+}
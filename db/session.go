@@ -42,8 +42,10 @@ func (session *TypeSession) SessionLoad(userId int64, moduleId int64) (TypeRows,
 	session.FieldAdd("ejaSession", "name", "text")
 	session.FieldAdd("ejaSession", "value", "text")
 	session.FieldAdd("ejaSession", "sub", "text")
+	session.Run("DELETE FROM ejaSession")
 	session.Run("DELETE FROM ejaSessions WHERE ejaOwner=? AND name in ('ejaId','ejaOwners')", userId)
 	session.Run("INSERT INTO ejaSession SELECT * FROM ejaSessions WHERE ejaOwner=?", userId)
+	session.idSync("ejaSession")
 	user := session.UserGetAllById(userId)
 	session.SessionPut(userId, "ejaModuleId", session.String(moduleId))
 	session.SessionPut(userId, "ejaModuleName", session.ModuleGetNameById(moduleId))
@@ -76,12 +78,12 @@ func (session *TypeSession) SessionPut(userId int64, name string, value string,
 }
 
 func (session *TypeSession) SessionCleanLink(userId int64) error {
-	_, err := session.Run("DELETE FROM ejaSessions WHERE ejaOwner=? AND name in ('Link','SqlQuery64','SqlQueryArgs','SearchLimit','SearchOffset','SearchOrder')", userId)
+	_, err := session.Run("DELETE FROM ejaSessions WHERE ejaOwner=? AND name in ('Link','SqlQuery64','SqlQueryArgs','SearchLimit','SearchOffset','SearchOrder','Trash')", userId)
 	return err
 }
 
 func (session *TypeSession) SessionCleanSearch(userId int64) error {
-	_, err := session.Run("DELETE FROM ejaSessions WHERE ejaOwner=? AND name in ('SqlQuery64','SqlQueryArgs','SearchLimit','SearchOffset','SearchOrder')", userId)
+	_, err := session.Run("DELETE FROM ejaSessions WHERE ejaOwner=? AND name in ('SqlQuery64','SqlQueryArgs','SearchLimit','SearchOffset','SearchOrder','Trash')", userId)
 	return err
 }
 
@@ -16,129 +16,142 @@ import (
 var Assets embed.FS
 
 func (session *TypeSession) Setup(setupPath string) error {
-	moduleIdMap := map[string]int64{}
-	var modules []TypeModule
-	var files []string
-	var err error
-
-	if setupPath != "" {
-		err := filepath.WalkDir(setupPath, func(path string, d fs.DirEntry, err error) error {
+	return session.WithTx(func(session *TypeSession) error {
+		// the initial data is not a change worth recording
+		quiet := *session
+		quiet.noAudit = true
+		session = &quiet
+
+		moduleIdMap := map[string]int64{}
+		var modules []TypeModule
+		var files []string
+		var err error
+
+		if setupPath != "" {
+			err := filepath.WalkDir(setupPath, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					files = append(files, path)
+				}
+				return nil
+			})
 			if err != nil {
 				return err
 			}
-			if !d.IsDir() {
-				files = append(files, path)
+		} else {
+			entries, err := fs.ReadDir(Assets, "assets")
+			if err != nil {
+				return err
 			}
-			return nil
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		entries, err := fs.ReadDir(Assets, "assets")
-		if err != nil {
-			return err
-		}
-		for _, entry := range entries {
-			if !entry.IsDir() {
-				files = append(files, "assets/"+entry.Name())
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					files = append(files, "assets/"+entry.Name())
+				}
 			}
 		}
-	}
 
-	sort.Strings(files) //very important for moduleLinks that must be at the end of the list
+		sort.Strings(files) //very important for moduleLinks that must be at the end of the list
 
-	for _, file := range files {
-		if filepath.Ext(file) == ".json" {
-			var fileContent []byte
-			if setupPath != "" {
-				fileContent, err = os.ReadFile(file)
-			} else {
-				fileContent, err = Assets.ReadFile(file)
-			}
-			if err != nil {
-				return err
-			}
+		for _, file := range files {
+			if filepath.Ext(file) == ".json" {
+				var fileContent []byte
+				if setupPath != "" {
+					fileContent, err = os.ReadFile(file)
+				} else {
+					fileContent, err = Assets.ReadFile(file)
+				}
+				if err != nil {
+					return err
+				}
 
-			var module TypeModule
-			if err := json.Unmarshal(fileContent, &module); err != nil {
-				return err
-			}
+				var module TypeModule
+				if err := json.Unmarshal(fileContent, &module); err != nil {
+					return err
+				}
 
-			if err := session.TableAdd(module.Name); err != nil {
-				return err
-			}
+				if err := session.TableAdd(module.Name); err != nil {
+					return err
+				}
 
-			for _, field := range module.Field {
-				switch field.Name {
-				case "ejaId", "ejaOwner", "ejaLog":
-					continue
-				default:
-					if err := session.FieldAdd(module.Name, field.Name, field.Type); err != nil {
-						return err
+				for _, field := range module.Field {
+					switch field.Name {
+					case "ejaId", "ejaOwner", "ejaLog":
+						continue
+					default:
+						if err := session.FieldAdd(module.Name, field.Name, field.Type); err != nil {
+							return err
+						}
 					}
 				}
-			}
 
-			// add commands
-			if module.Name == "ejaCommands" {
-				for _, data := range module.Data {
-					_, err := session.Run(
-						"INSERT INTO ejaCommands (ejaId, ejaOwner, ejaLog, name, powerSearch, powerList, powerEdit, linking, defaultCommand) VALUES (NULL,1,?,?,?,?,?,?,?)",
-						session.Now(),
-						data["name"],
-						data["powerSearch"],
-						data["powerList"],
-						data["powerEdit"],
-						data["linking"],
-						data["defaultCommand"],
-					)
-					if err != nil {
-						return err
+				// add commands
+				if module.Name == "ejaCommands" {
+					for _, data := range module.Data {
+						_, err := session.Run(
+							"INSERT INTO ejaCommands (ejaId, ejaOwner, ejaLog, name, powerSearch, powerList, powerEdit, linking, defaultCommand) VALUES (NULL,1,?,?,?,?,?,?,?)",
+							session.Now(),
+							data["name"],
+							data["powerSearch"],
+							data["powerList"],
+							data["powerEdit"],
+							data["linking"],
+							data["defaultCommand"],
+						)
+						if err != nil {
+							return err
+						}
 					}
+					module.Data = nil
 				}
-				module.Data = nil
-			}
 
-			modules = append(modules, module)
+				modules = append(modules, module)
+			}
 		}
-	}
 
-	// add modules
-	for _, module := range modules {
-		_, err = session.Run(
-			"INSERT INTO ejaModules (ejaId, ejaOwner, ejaLog, name, power, searchLimit, sqlCreated, sortList, parentId) VALUES (NULL, 1, ?, ?, ?, ?, ?, ?, 0)",
-			session.Now(),
-			module.Name,
-			module.Module.Power,
-			module.Module.SearchLimit,
-			module.Module.SqlCreated,
-			module.Module.SortList,
-		)
-		if err != nil {
-			return err
+		// add modules
+		for _, module := range modules {
+			_, err = session.Run(
+				"INSERT INTO ejaModules (ejaId, ejaOwner, ejaLog, name, power, searchLimit, sqlCreated, sortList, parentId) VALUES (NULL, 1, ?, ?, ?, ?, ?, ?, 0)",
+				session.Now(),
+				module.Name,
+				module.Module.Power,
+				module.Module.SearchLimit,
+				module.Module.SqlCreated,
+				module.Module.SortList,
+			)
+			if err != nil {
+				return err
+			}
 		}
-	}
-	for _, module := range modules {
-		moduleParentId := session.ModuleGetIdByName(module.Module.ParentName)
-		moduleId := session.ModuleGetIdByName(module.Name)
-		if moduleId > 0 {
-			moduleIdMap[module.Name] = moduleId
-			if moduleParentId > 0 {
-				_, err := session.Run("UPDATE ejaModules SET parentId=? WHERE ejaId=?", moduleParentId, moduleId)
-				if err != nil {
-					return err
+		for _, module := range modules {
+			moduleParentId := session.ModuleGetIdByName(module.Module.ParentName)
+			moduleId := session.ModuleGetIdByName(module.Name)
+			if moduleId > 0 {
+				moduleIdMap[module.Name] = moduleId
+				if moduleParentId > 0 {
+					_, err := session.Run("UPDATE ejaModules SET parentId=? WHERE ejaId=?", moduleParentId, moduleId)
+					if err != nil {
+						return err
+					}
 				}
 			}
 		}
-	}
-	for _, module := range modules {
-		if err := session.ModuleImport(module, module.Name); err != nil {
-			return err
+		for _, module := range modules {
+			if err := session.ModuleImport(module, module.Name); err != nil {
+				return err
+			}
 		}
-	}
 
-	return nil
+		for _, index := range setupIndexes {
+			if err := session.IndexAdd(index); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 func (session *TypeSession) SetupAdmin(setupUser string, setupPass string) error {
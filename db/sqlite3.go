@@ -6,7 +6,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"regexp"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -17,7 +19,11 @@ var (
 	sqliteValidFieldNameRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]{0,127}$`)
 )
 
-func sqliteOpen(path string) (*sql.DB, error) {
+type sqliteEngine struct {
+	TypeEngineSql
+}
+
+func (engine *sqliteEngine) Open(path string, username string, password string, host string, port int) (*sql.DB, error) {
 	dsn := fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(on)", path)
 
 	db, err := sql.Open("sqlite", dsn)
@@ -36,125 +42,8 @@ func sqliteOpen(path string) (*sql.DB, error) {
 	return db, nil
 }
 
-func (session *TypeSession) sqliteRun(query string, args ...any) (TypeRun, error) {
-	result, err := session.Handler.Exec(query, args...)
-	if err != nil {
-		return TypeRun{}, err
-	}
-	lastId, _ := result.LastInsertId()
-	changes, _ := result.RowsAffected()
-	return TypeRun{Changes: changes, LastId: lastId}, nil
-}
-
-func (session *TypeSession) sqliteValue(query string, args ...any) (string, error) {
-	var nullResult sql.NullString
-	err := session.Handler.QueryRow(query, args...).Scan(&nullResult)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", nil
-		}
-		return "", err
-	}
-	if nullResult.Valid {
-		return nullResult.String, nil
-	}
-	return "", nil
-}
-
-func (session *TypeSession) sqliteRow(query string, args ...any) (TypeRow, error) {
-	rows, err := session.Handler.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return nil, err
-		}
-		return nil, nil
-	}
-
-	values := make([]sql.RawBytes, len(columns))
-	scanArgs := make([]any, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
-	}
-
-	if err := rows.Scan(scanArgs...); err != nil {
-		return nil, err
-	}
-
-	result := make(TypeRow)
-	for i, col := range values {
-		if col == nil {
-			result[columns[i]] = ""
-		} else {
-			result[columns[i]] = string(col)
-		}
-	}
-
-	return result, nil
-}
-
-func (session *TypeSession) sqliteRows(query string, args ...any) (TypeRows, error) {
-	rows, err := session.Handler.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, err
-	}
-
-	var result TypeRows
-	values := make([]sql.RawBytes, len(columns))
-	scanArgs := make([]any, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
-	}
-
-	for rows.Next() {
-		err := rows.Scan(scanArgs...)
-		if err != nil {
-			return nil, err
-		}
-		row := make(TypeRow)
-		for i, col := range values {
-			if col == nil {
-				row[columns[i]] = ""
-			} else {
-				row[columns[i]] = string(col)
-			}
-		}
-		result = append(result, row)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return result, nil
-}
-
-func (session *TypeSession) sqliteCols(query string, args ...any) ([]string, error) {
-	rows, err := session.Handler.Query(query, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	return rows.Columns()
-}
-
-func (session *TypeSession) sqliteTableExists(name string) (bool, error) {
-	if err := sqliteTableNameIsValid(name); err != nil {
+func (engine *sqliteEngine) TableExists(session *TypeSession, name string) (bool, error) {
+	if err := engine.TableNameIsValid(name); err != nil {
 		return false, err
 	}
 	query := `
@@ -165,25 +54,25 @@ func (session *TypeSession) sqliteTableExists(name string) (bool, error) {
 		)
 	`
 	var count int
-	err := session.Handler.QueryRow(query, name, name).Scan(&count)
+	err := session.Querier().QueryRowContext(session.Context(), query, name, name).Scan(&count)
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
 
-func (session *TypeSession) sqliteFieldExists(tableName, fieldName string) (bool, error) {
-	if err := sqliteTableNameIsValid(tableName); err != nil {
+func (engine *sqliteEngine) FieldExists(session *TypeSession, tableName, fieldName string) (bool, error) {
+	if err := engine.TableNameIsValid(tableName); err != nil {
 		return false, err
 	}
-	if err := sqliteFieldNameIsValid(fieldName); err != nil {
+	if err := engine.FieldNameIsValid(fieldName); err != nil {
 		return false, err
 	}
 
 	query := fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name = ?", tableName)
 
 	var count int
-	err := session.Handler.QueryRow(query, fieldName).Scan(&count)
+	err := session.Querier().QueryRowContext(session.Context(), query, fieldName).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -191,25 +80,31 @@ func (session *TypeSession) sqliteFieldExists(tableName, fieldName string) (bool
 	return count > 0, nil
 }
 
-func sqliteTableNameIsValid(name string) error {
+func (engine *sqliteEngine) TableAdd(tableName string, temporary bool) []string {
+	return []string{
+		fmt.Sprintf("CREATE %s TABLE %s (ejaId INTEGER PRIMARY KEY, ejaOwner INTEGER, ejaLog DATETIME)", engineTemporary(temporary), tableName),
+	}
+}
+
+func (engine *sqliteEngine) TableNameIsValid(name string) error {
 	if !sqliteValidTableNameRegex.MatchString(name) {
 		return errors.New("table name is not valid")
 	}
 	return nil
 }
 
-func sqliteFieldNameIsValid(name string) error {
+func (engine *sqliteEngine) FieldNameIsValid(name string) error {
 	if !sqliteValidFieldNameRegex.MatchString(name) {
 		return errors.New("field name is not valid")
 	}
 	return nil
 }
 
-func (session *TypeSession) sqliteFtsAdd(tableName, columnName string) error {
-	if err := sqliteTableNameIsValid(tableName); err != nil {
+func (engine *sqliteEngine) FtsAdd(session *TypeSession, tableName, columnName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
 		return err
 	}
-	if err := sqliteFieldNameIsValid(columnName); err != nil {
+	if err := engine.FieldNameIsValid(columnName); err != nil {
 		return err
 	}
 
@@ -219,7 +114,7 @@ func (session *TypeSession) sqliteFtsAdd(tableName, columnName string) error {
 		"CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='rowid')",
 		ftsTableName, columnName, tableName,
 	)
-	if _, err := session.Handler.Exec(createFts); err != nil {
+	if _, err := session.Querier().ExecContext(session.Context(), createFts); err != nil {
 		return err
 	}
 
@@ -239,13 +134,122 @@ func (session *TypeSession) sqliteFtsAdd(tableName, columnName string) error {
 			INSERT INTO %s(rowid, %s) VALUES(new.rowid, new.%s);
 		END;`, ftsTableName, tableName, ftsTableName, ftsTableName, columnName, columnName, ftsTableName, columnName, columnName)
 
-	session.Handler.Exec(ai)
-	session.Handler.Exec(ad)
-	session.Handler.Exec(au)
+	session.Querier().ExecContext(session.Context(), ai)
+	session.Querier().ExecContext(session.Context(), ad)
+	session.Querier().ExecContext(session.Context(), au)
 
 	syncSql := fmt.Sprintf("INSERT INTO %s(rowid, %s) SELECT rowid, %s FROM %s",
 		ftsTableName, columnName, columnName, tableName)
-	session.Handler.Exec(syncSql)
+	session.Querier().ExecContext(session.Context(), syncSql)
 
 	return nil
 }
+
+func (engine *sqliteEngine) FtsDel(session *TypeSession, tableName, columnName string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	if err := engine.FieldNameIsValid(columnName); err != nil {
+		return err
+	}
+
+	ftsTableName := fmt.Sprintf("ejaFTS_%s_%s", tableName, columnName)
+	for _, suffix := range []string{"ai", "ad", "au"} {
+		if _, err := session.Querier().ExecContext(session.Context(), fmt.Sprintf("DROP TRIGGER IF EXISTS %s_%s", ftsTableName, suffix)); err != nil {
+			return err
+		}
+	}
+	_, err := session.Querier().ExecContext(session.Context(), "DROP TABLE IF EXISTS "+ftsTableName)
+	return err
+}
+
+func (engine *sqliteEngine) FieldDel(session *TypeSession, tableName string, fieldName string) error {
+	return engine.rebuild(session, tableName, fieldName, "")
+}
+
+func (engine *sqliteEngine) FieldRetype(session *TypeSession, tableName string, fieldName string, sqlType string) error {
+	return engine.rebuild(session, tableName, fieldName, sqlType)
+}
+
+// rebuild copies the table into a new one where fieldName has sqlType, or is
+// left out when sqlType is empty, since SQLite cannot alter a column type and
+// only drops columns that are not referenced by indexes or triggers.
+func (engine *sqliteEngine) rebuild(session *TypeSession, tableName string, fieldName string, sqlType string) error {
+	if err := engine.TableNameIsValid(tableName); err != nil {
+		return err
+	}
+	if err := engine.FieldNameIsValid(fieldName); err != nil {
+		return err
+	}
+
+	columns, err := engine.Rows(session, fmt.Sprintf("SELECT name, type, pk FROM pragma_table_info('%s') ORDER BY cid", tableName))
+	if err != nil {
+		return err
+	}
+	schema, err := engine.Rows(session, "SELECT sql FROM sqlite_master WHERE tbl_name=? AND type IN ('index','trigger') AND sql IS NOT NULL", tableName)
+	if err != nil {
+		return err
+	}
+
+	var definitions, names []string
+	for _, column := range columns {
+		definition := column["name"] + " " + column["type"]
+		if column["name"] == fieldName {
+			if sqlType == "" {
+				continue
+			}
+			definition = column["name"] + " " + sqlType
+		}
+		if column["pk"] == "1" {
+			definition += " PRIMARY KEY"
+		}
+		definitions = append(definitions, definition)
+		names = append(names, column["name"])
+	}
+
+	rebuildName := "ejaRebuild_" + tableName
+	queries := []string{
+		fmt.Sprintf("CREATE TABLE %s (%s)", rebuildName, strings.Join(definitions, ", ")),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", rebuildName, strings.Join(names, ","), strings.Join(names, ","), tableName),
+		fmt.Sprintf("DROP TABLE %s", tableName),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuildName, tableName),
+	}
+	for _, query := range queries {
+		if _, err := session.Querier().ExecContext(session.Context(), query); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range schema {
+		if _, err := session.Querier().ExecContext(session.Context(), row["sql"]); err != nil {
+			slog.Warn("table rebuild, schema object not restored", "table", tableName, "sql", row["sql"], "error", err)
+		}
+	}
+
+	return nil
+}
+
+func (engine *sqliteEngine) SearchFts(tableName string, fieldName string) string {
+	return fmt.Sprintf(" AND rowid IN (SELECT rowid FROM ejaFTS_%s_%s WHERE %s MATCH ?) ", tableName, fieldName, fieldName)
+}
+
+func (engine *sqliteEngine) Formula(function string, args []string) string {
+	switch function {
+	case "years":
+		return fmt.Sprintf("(CAST(strftime('%%Y', 'now') AS INTEGER) - CAST(strftime('%%Y', %s) AS INTEGER) - (strftime('%%m-%%d', 'now') < strftime('%%m-%%d', %s)))", args[0], args[0])
+	case "days":
+		return fmt.Sprintf("CAST(julianday(%s) - julianday(%s) AS INTEGER)", formulaDefault(args, 1, "date('now')"), args[0])
+	}
+	return engine.TypeEngineSql.Formula(function, args)
+}
+
+func (engine *sqliteEngine) WindowCount(session *TypeSession) bool {
+	return true
+}
+
+// Lock takes the database write lock, sqlite has no row locks and a deferred
+// transaction only gets it with its first write.
+func (engine *sqliteEngine) Lock(session *TypeSession, tableName string, ejaId int64) error {
+	_, err := session.Run(fmt.Sprintf("UPDATE %s SET ejaId=ejaId WHERE ejaId=?", tableName), ejaId)
+	return err
+}
@@ -2,10 +2,10 @@
 
 package db
 
-import ()
+import "fmt"
 
 func (session *TypeSession) IsSubModule(moduleId int64) bool {
-	value, err := session.Value(`SELECT srcFieldName FROM ejaModuleLinks WHERE srcModuleId=? AND srcFieldName != "" LIMIT 1`, moduleId)
+	value, err := session.Value(`SELECT srcFieldName FROM ejaModuleLinks WHERE srcModuleId=? AND srcFieldName != '' LIMIT 1`, moduleId)
 	if err == nil && value != "" {
 		return true
 	}
@@ -15,13 +15,13 @@ func (session *TypeSession) IsSubModule(moduleId int64) bool {
 func (session *TypeSession) SubModules(ownerId int64, moduleId int64) (result []TypeLink) {
 	ejaPermissions := session.ModuleGetIdByName("ejaPermissions")
 	ejaUsers := session.ModuleGetIdByName("ejaUsers")
-	rows, err := session.Rows(`
-		SELECT srcModuleId, (SELECT name FROM ejaModules WHERE ejaId=srcModuleId) AS srcModuleName 
+	rows, err := session.Rows(fmt.Sprintf(`
+		SELECT srcModuleId, (SELECT name FROM ejaModules WHERE ejaId=%s) AS srcModuleName 
 		FROM ejaModuleLinks 
 		WHERE dstModuleId=? 
-        AND srcFieldName != ""
+        AND srcFieldName != ''
 		ORDER BY power ASC
-		`, moduleId)
+		`, session.integerSql("srcModuleId")), moduleId)
 	if err != nil {
 		return
 	}
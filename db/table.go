@@ -8,48 +8,35 @@ import (
 )
 
 func (session *TypeSession) TableExists(name string) (bool, error) {
-	switch session.Engine {
-	case "sqlite":
-		return session.sqliteTableExists(name)
-	case "mysql":
-		return session.mysqlTableExists(name)
-	default:
-		return false, errors.New("engine not found")
+	engine, err := session.engine()
+	if err != nil {
+		return false, err
 	}
+	return engine.TableExists(session, name)
 }
 
 func (session *TypeSession) TableNameIsValid(name string) error {
-	switch session.Engine {
-	case "sqlite":
-		return sqliteTableNameIsValid(name)
-	case "mysql":
-		return mysqlTableNameIsValid(name)
-	default:
-		return errors.New("engine not found")
+	engine, err := session.engine()
+	if err != nil {
+		return err
 	}
+	return engine.TableNameIsValid(name)
 }
 
 func (session *TypeSession) TableAdd(name string, tmp ...bool) error {
+	engine, err := session.engine()
+	if err != nil {
+		return err
+	}
 	check, err := session.TableExists(name)
 	if err != nil {
 		return err
 	}
 	if !check {
-		temporary := ""
-		if len(tmp) > 0 {
-			temporary = "TEMPORARY"
-		}
-		switch session.Engine {
-		case "sqlite":
-			if _, err := session.Run(fmt.Sprintf("CREATE %s TABLE %s (ejaId INTEGER PRIMARY KEY, ejaOwner INTEGER, ejaLog DATETIME)", temporary, name)); err != nil {
-				return err
-			}
-		case "mysql":
-			if _, err := session.Run(fmt.Sprintf("CREATE %s TABLE %s (ejaId INTEGER AUTO_INCREMENT PRIMARY KEY, ejaOwner INTEGER, ejaLog DATETIME)", temporary, name)); err != nil {
+		for _, query := range engine.TableAdd(name, len(tmp) > 0) {
+			if _, err := session.Run(query); err != nil {
 				return err
 			}
-		default:
-			return errors.New("engine not found")
 		}
 	}
 	return nil
@@ -0,0 +1,103 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// aggregateTypes lists the field types each aggregate of ejaFields applies to,
+// count works on every field backed by a value.
+var aggregateTypes = map[string][]string{
+	"sum": {"integer", "decimal", "money", "formula"},
+	"avg": {"integer", "decimal", "money", "formula"},
+	"min": {"integer", "decimal", "money", "formula", "date", "time", "datetime"},
+	"max": {"integer", "decimal", "money", "formula", "date", "time", "datetime"},
+}
+
+// SearchTotals computes the aggregate set on the list fields of moduleId over
+// every row of query, the same list query SearchCount counts, and returns the
+// formatted results by field name.
+func (session *TypeSession) SearchTotals(ownerId int64, moduleId int64, query string, args []any) map[string]string {
+	if check, err := session.FieldExists("ejaFields", "aggregate"); err != nil || !check {
+		return nil
+	}
+	rows, err := session.Rows("SELECT name, type, value, aggregate FROM ejaFields WHERE ejaModuleId=? AND powerList>0 AND aggregate<>'' ORDER BY powerList", moduleId)
+	if err != nil {
+		slog.Warn("search totals", "module", moduleId, "error", err)
+		return nil
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]TypeRow)
+	var columns []string
+	for _, row := range rows {
+		name, fieldType, aggregate := row["name"], row["type"], row["aggregate"]
+		if session.FieldNameIsValid(name) != nil || (!fieldHasColumn(fieldType) && fieldType != "formula") {
+			continue
+		}
+		if types, ok := aggregateTypes[aggregate]; ok {
+			if !slices.Contains(types, fieldType) {
+				continue
+			}
+		} else if aggregate != "count" {
+			continue
+		}
+		fields[name] = row
+		columns = append(columns, fmt.Sprintf("%s(%s) AS %s", strings.ToUpper(aggregate), name, name))
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	row, err := session.Row("SELECT "+strings.Join(columns, ", ")+" FROM ("+query+") AS T", args...)
+	if err != nil {
+		slog.Warn("search totals", "module", moduleId, "error", err)
+		return nil
+	}
+
+	totals := make(map[string]string)
+	for name, field := range fields {
+		totals[name] = session.searchTotal(ownerId, field, row[name])
+	}
+	return totals
+}
+
+// searchTotal formats the aggregate value of field the way the list shows it.
+func (session *TypeSession) searchTotal(ownerId int64, field TypeRow, value string) string {
+	if value == "" || field["aggregate"] == "count" {
+		return value
+	}
+	switch field["type"] {
+	case "money":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value
+		}
+		return MoneyField(field["value"]).Format(int64(math.Round(number)), session.UserLanguage(ownerId))
+	case "date":
+		if len(value) >= 10 {
+			return value[:10]
+		}
+	case "datetime":
+		if len(value) >= 19 {
+			return value[:10] + " " + value[11:19]
+		}
+	case "time":
+		if len(value) >= 19 {
+			return value[11:19]
+		}
+	default:
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			return strconv.FormatFloat(math.Round(number*1e6)/1e6, 'f', -1, 64)
+		}
+	}
+	return value
+}
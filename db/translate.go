@@ -4,6 +4,7 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 )
 
@@ -14,22 +15,22 @@ func (session *TypeSession) Translate(value string, user ...int64) string {
 		userId = user[0]
 	}
 	if userId > 0 {
-		result, _ = session.Value(`
+		result, _ = session.Value(fmt.Sprintf(`
 			SELECT translation
 			FROM ejaTranslations
 			WHERE word = ?
  	   		AND ejaLanguage = (SELECT ejaLanguage FROM ejaUsers WHERE ejaUsers.ejaId = ?)
  	   		AND (
-        	ejaModuleId = 0
+        	%s = 0
         	OR ejaModuleId = ''
         	OR ejaModuleId = (
         	SELECT value FROM ejaSessions WHERE ejaSessions.name = 'ejaModuleId' AND ejaSessions.ejaOwner = ?)
     		)
 			ORDER BY ejaModuleId DESC
 			LIMIT 1
-			`, value, userId, userId)
+			`, session.integerSql("ejaModuleId")), value, userId, userId)
 	} else {
-		result, _ = session.Value("SELECT translation FROM ejaTranslations WHERE word=? AND (ejaLanguage=0 OR ejaLanguage='') LIMIT 1", value)
+		result, _ = session.Value(fmt.Sprintf("SELECT translation FROM ejaTranslations WHERE word=? AND (%s=0 OR ejaLanguage='') LIMIT 1", session.integerSql("ejaLanguage")), value)
 	}
 	if result == "" {
 		if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
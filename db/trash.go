@@ -0,0 +1,143 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// trashField marks a trashed record with the time it was deleted, records
+// with a NULL value are alive.
+const trashField = "ejaTrash"
+
+var trashCommands = []string{"trash", "restore", "purge"}
+
+// ModuleTrash tells whether delete only moves the module records to the trash.
+func (session *TypeSession) ModuleTrash(moduleId int64) bool {
+	row, err := session.Row("SELECT * FROM ejaModules WHERE ejaId=?", moduleId)
+	if err != nil {
+		return false
+	}
+	return session.Number(row["trash"]) > 0
+}
+
+// TrashEnable adds the trash column to the module table and the trash, restore
+// and purge permissions that are missing, granting them to userId.
+func (session *TypeSession) TrashEnable(userId int64, moduleId int64) error {
+	return session.WithTx(func(session *TypeSession) error {
+		if err := session.trashFieldAdd(session.ModuleGetNameById(moduleId)); err != nil {
+			return err
+		}
+
+		for _, command := range trashCommands {
+			count, err := session.Value(fmt.Sprintf(`
+				SELECT COUNT(*) FROM ejaPermissions
+				WHERE ejaModuleId=? AND %s=(SELECT c.ejaId FROM ejaCommands AS c WHERE c.name=? LIMIT 1)
+				`, session.integerSql("ejaCommandId")), moduleId, command)
+			if err != nil {
+				return err
+			}
+			if session.Number(count) > 0 {
+				continue
+			}
+			commandId, err := session.Value("SELECT ejaId FROM ejaCommands WHERE name=?", command)
+			if err != nil {
+				return err
+			}
+			if commandId == "" {
+				continue
+			}
+			run, err := session.Run(`
+				INSERT INTO ejaPermissions
+					(ejaId, ejaOwner, ejaLog, ejaModuleId, ejaCommandId)
+				VALUES (NULL,?,?,?,?)
+				`, userId, session.Now(), moduleId, commandId)
+			if err != nil {
+				return err
+			}
+			if _, err := session.Run(`
+				INSERT INTO ejaLinks
+					(ejaId, ejaOwner, ejaLog, srcModuleId, srcFieldId, dstModuleId, dstFieldId, power)
+				VALUES
+					(NULL,1,?,?,?,?,?,2)
+				`, session.Now(), session.ModuleGetIdByName("ejaPermissions"), run.LastId, session.ModuleGetIdByName("ejaUsers"), userId); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (session *TypeSession) trashFieldAdd(tableName string) error {
+	if check, err := session.TableExists(tableName); err != nil || !check {
+		return err
+	}
+	if check, err := session.FieldExists(tableName, trashField); err != nil || check {
+		return err
+	}
+	return session.FieldAdd(tableName, trashField, "datetime")
+}
+
+// trashFilter returns the condition that keeps trashed records out of a
+// search on tableName, or selects only them when trashed is true.
+func (session *TypeSession) trashFilter(tableName string, trashed bool) string {
+	if check, _ := session.FieldExists(tableName, trashField); !check {
+		if trashed {
+			return " AND 1=0 "
+		}
+		return ""
+	}
+	if trashed {
+		return fmt.Sprintf(" AND %s IS NOT NULL ", trashField)
+	}
+	return fmt.Sprintf(" AND %s IS NULL ", trashField)
+}
+
+// Trash marks the record as deleted keeping its values and links.
+func (session *TypeSession) Trash(ownerId int64, moduleId int64, ejaId int64) error {
+	return session.trashSet(ownerId, moduleId, ejaId, "trash", session.Now())
+}
+
+// Restore brings a trashed record back.
+func (session *TypeSession) Restore(ownerId int64, moduleId int64, ejaId int64) error {
+	return session.trashSet(ownerId, moduleId, ejaId, "restore", nil)
+}
+
+func (session *TypeSession) trashSet(ownerId int64, moduleId int64, ejaId int64, action string, value any) error {
+	moduleName := session.ModuleGetNameById(moduleId)
+	if err := session.trashFieldAdd(moduleName); err != nil {
+		return err
+	}
+	if check, err := session.FieldExists(moduleName, trashField); err != nil || !check {
+		if err == nil {
+			err = errors.New("table not found")
+		}
+		return err
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s=? WHERE ejaId=? AND ejaOwner IN (%s)", moduleName, trashField, session.OwnersCsv(ownerId, moduleId))
+	run, err := session.Run(query, value, ejaId)
+	if err != nil || run.Changes == 0 {
+		return err
+	}
+	return session.audit(ownerId, action, moduleId, ejaId, "", "", "")
+}
+
+// Purge removes a trashed record for good, records that are not in the trash
+// are left untouched and modules without a trash return an error.
+func (session *TypeSession) Purge(ownerId int64, moduleId int64, ejaId int64) error {
+	moduleName := session.ModuleGetNameById(moduleId)
+	if check, err := session.FieldExists(moduleName, trashField); err != nil || !check {
+		if err == nil {
+			err = errors.New("trash not enabled")
+		}
+		return err
+	}
+	trashed, err := session.Value(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE ejaId=? AND %s IS NOT NULL", moduleName, trashField), ejaId)
+	if err != nil || session.Number(trashed) == 0 {
+		return err
+	}
+	return session.remove(ownerId, moduleId, ejaId)
+}
@@ -7,9 +7,10 @@ import (
 )
 
 type TypeModuleTree struct {
-	Id    int64
-	Name  string
-	Label string
+	Id       int64
+	Name     string
+	Label    string
+	SearchId int64 `json:",omitempty"`
 }
 
 func (session *TypeSession) ModuleTree(ownerId int64, moduleId int64, modulePath []TypeModulePath) (result []TypeModuleTree) {
@@ -26,7 +27,7 @@ func (session *TypeSession) ModuleTree(ownerId int64, moduleId int64, modulePath
 
 	if len(rows) == 0 {
 		if len(modulePath) == 0 {
-			rows, err = session.Rows("SELECT ejaId, name FROM ejaModules WHERE parentId=0 AND ejaId!=? ORDER BY power ASC", moduleId)
+			rows, err = session.Rows(fmt.Sprintf("SELECT ejaId, name FROM ejaModules WHERE %s=0 AND ejaId!=? ORDER BY power ASC", session.integerSql("parentId")), moduleId)
 			if err != nil {
 				return
 			}
@@ -59,5 +60,12 @@ func (session *TypeSession) ModuleTree(ownerId int64, moduleId int64, modulePath
 		}
 	}
 
+	// pinned saved searches follow the modules
+	for _, search := range session.SavedSearches(ownerId, 0, true) {
+		if commands, err := session.Commands(ownerId, search.ModuleId, ""); err == nil && session.CommandExists(commands, "search") {
+			result = append(result, TypeModuleTree{Id: search.ModuleId, Name: session.ModuleGetNameById(search.ModuleId), Label: search.Name, SearchId: search.Id})
+		}
+	}
+
 	return
 }
@@ -0,0 +1,88 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+)
+
+// Begin returns a copy of the session bound to a new transaction, every helper
+// called on the copy takes part in it until Commit or Rollback. MySQL commits
+// implicitly on schema changes, so callers run them after every other write.
+func (session *TypeSession) Begin() (TypeSession, error) {
+	if session.tx != nil {
+		return TypeSession{}, errors.New("transaction already started")
+	}
+
+	var tx *sql.Tx
+	var err error
+	switch {
+	case session.conn != nil:
+		tx, err = session.conn.BeginTx(session.Context(), nil)
+	case session.Handler != nil:
+		tx, err = session.Handler.BeginTx(session.Context(), nil)
+	default:
+		err = errors.New("no database connection")
+	}
+	if err != nil {
+		return TypeSession{}, err
+	}
+
+	bound := *session
+	bound.tx = tx
+	slog.Debug("DB begin", "engine", session.Engine)
+	return bound, nil
+}
+
+func (session *TypeSession) Commit() error {
+	if session.tx == nil {
+		return errors.New("no transaction to commit")
+	}
+	err := session.tx.Commit()
+	session.tx = nil
+	slog.Debug("DB commit", "engine", session.Engine, "error", err)
+	return err
+}
+
+func (session *TypeSession) Rollback() error {
+	if session.tx == nil {
+		return errors.New("no transaction to rollback")
+	}
+	err := session.tx.Rollback()
+	session.tx = nil
+	slog.Debug("DB rollback", "engine", session.Engine, "error", err)
+	return err
+}
+
+func (session *TypeSession) InTx() bool {
+	return session.tx != nil
+}
+
+// WithTx runs fn inside a transaction that is committed when fn returns nil
+// and rolled back otherwise. When the session is already in a transaction fn
+// simply joins it, so atomic helpers can call each other.
+func (session *TypeSession) WithTx(fn func(tx *TypeSession) error) (err error) {
+	if session.tx != nil {
+		return fn(session)
+	}
+
+	tx, err := session.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = fn(&tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
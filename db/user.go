@@ -29,12 +29,12 @@ func (session *TypeSession) UserGetAllBySession(sessionHash string) TypeRow {
 	if sessionHash == "" {
 		return nil
 	}
-	if row, err := session.Row(`SELECT * FROM ejaUsers WHERE ejaSession = ? AND ejaSession != "" LIMIT 1`, sessionHash); err == nil && len(row) > 0 {
+	if row, err := session.Row(`SELECT * FROM ejaUsers WHERE ejaSession = ? AND ejaSession != '' LIMIT 1`, sessionHash); err == nil && len(row) > 0 {
 		return row
 	}
 	timeNow := time.Now().Unix() / SESSION_EXPIRE
 	timePre := timeNow - 1
-	rows, err := session.Rows(`SELECT * FROM ejaUsers WHERE ejaSession != ""`)
+	rows, err := session.Rows(`SELECT * FROM ejaUsers WHERE ejaSession != ''`)
 	if err == nil {
 		for _, row := range rows {
 			hashNow := session.Sha256(fmt.Sprintf("%s.%s.%d", row["ejaSession"], row["ejaId"], timeNow))
@@ -53,10 +53,16 @@ func (session *TypeSession) UserGetAllByUsername(username string) TypeRow {
 }
 
 func (session *TypeSession) UserPermissionCopy(userId int64, moduleId int64) {
-	session.Run(`
-		INSERT INTO ejaLinks (ejaId, ejaOwner, ejaLog, srcModuleId, srcFieldId, dstModuleId, dstFieldId, power)
-		SELECT NULL, 1, ?, ?, ejaId, ?, ?, 2
-		FROM ejaPermissions
-		WHERE ejaModuleId = ?;
-		`, session.Now(), session.ModuleGetIdByName("ejaPermissions"), session.ModuleGetIdByName("ejaUsers"), userId, moduleId)
+	rows, err := session.Rows("SELECT ejaId FROM ejaPermissions WHERE ejaModuleId = ?", moduleId)
+	if err != nil {
+		return
+	}
+	permissionsId := session.ModuleGetIdByName("ejaPermissions")
+	usersId := session.ModuleGetIdByName("ejaUsers")
+	for _, row := range rows {
+		session.Run(`
+			INSERT INTO ejaLinks (ejaId, ejaOwner, ejaLog, srcModuleId, srcFieldId, dstModuleId, dstFieldId, power)
+			VALUES (NULL, 1, ?, ?, ?, ?, ?, 2)
+			`, session.Now(), permissionsId, row["ejaId"], usersId, userId)
+	}
 }
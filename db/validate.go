@@ -0,0 +1,244 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// TypeFieldRule holds the validation metadata of a field, ValueMin and
+// ValueMax are compared as numbers on numeric fields and as text on dates and
+// times, Pattern must match the whole value.
+type TypeFieldRule struct {
+	Name        string
+	Type        string
+	Required    bool
+	ValueMin    string
+	ValueMax    string
+	LengthMin   int64
+	LengthMax   int64
+	Pattern     string
+	ValueUnique bool
+}
+
+// TypeFieldError is a failed rule, Word is the translation key and Limit the
+// bound that was not respected, if any.
+type TypeFieldError struct {
+	Word  string
+	Limit string
+}
+
+type TypeFieldErrors map[string]TypeFieldError
+
+func (errs TypeFieldErrors) Error() string {
+	var result []string
+	for name, err := range errs {
+		result = append(result, strings.TrimSpace(fmt.Sprintf("%s: %s %s", name, err.Word, err.Limit)))
+	}
+	return strings.Join(result, ", ")
+}
+
+func (rule TypeFieldRule) empty() bool {
+	return !rule.Required && rule.ValueMin == "" && rule.ValueMax == "" && rule.LengthMin == 0 && rule.LengthMax == 0 && rule.Pattern == "" && !rule.ValueUnique
+}
+
+// FieldRules returns the validation rules of the module fields stored in a column.
+func (session *TypeSession) FieldRules(moduleId int64) (rules []TypeFieldRule, err error) {
+	rows, err := session.Rows("SELECT * FROM ejaFields WHERE ejaModuleId=? ORDER BY ejaId", moduleId)
+	if err != nil {
+		return
+	}
+	for _, row := range rows {
+		if !fieldHasColumn(row["type"]) {
+			continue
+		}
+		rules = append(rules, TypeFieldRule{
+			Name:        row["name"],
+			Type:        row["type"],
+			Required:    session.Number(row["required"]) > 0,
+			ValueMin:    row["valueMin"],
+			ValueMax:    row["valueMax"],
+			LengthMin:   session.Number(row["lengthMin"]),
+			LengthMax:   session.Number(row["lengthMax"]),
+			Pattern:     row["pattern"],
+			ValueUnique: session.Number(row["valueUnique"]) > 0,
+		})
+	}
+	return
+}
+
+// Validate checks values against the module rules, ejaId is the record being
+// saved or 0 for a new one. Fields missing from values keep the stored value
+// and are only checked for presence.
+func (session *TypeSession) Validate(moduleId int64, ejaId int64, values map[string]string) (TypeFieldErrors, error) {
+	rules, err := session.FieldRules(moduleId)
+	if err != nil {
+		return nil, err
+	}
+	return session.validate(session.ModuleGetNameById(moduleId), rules, ejaId, values)
+}
+
+func (session *TypeSession) validate(tableName string, rules []TypeFieldRule, ejaId int64, values map[string]string) (TypeFieldErrors, error) {
+	errs := TypeFieldErrors{}
+	var stored TypeRow
+	var err error
+
+	for _, rule := range rules {
+		value, posted := values[rule.Name]
+		value = strings.TrimSpace(value)
+
+		if posted && value != "" {
+			if word := validateType(rule.Type, value); word != "" {
+				errs[rule.Name] = TypeFieldError{Word: word}
+				continue
+			}
+		}
+		if rule.empty() {
+			continue
+		}
+
+		if !posted {
+			if !rule.Required {
+				continue
+			}
+			if stored == nil && ejaId > 0 {
+				// the stored row is read once, only when a required field was not posted
+				if err := session.TableNameIsValid(tableName); err != nil {
+					return nil, err
+				}
+				if stored, err = session.Row(fmt.Sprintf("SELECT * FROM %s WHERE ejaId=?", tableName), ejaId); err != nil {
+					return nil, err
+				}
+			}
+			value = strings.TrimSpace(stored[rule.Name])
+		}
+
+		if value == "" {
+			if rule.Required {
+				errs[rule.Name] = TypeFieldError{Word: "ejaValidateRequired"}
+			}
+			continue
+		}
+		if !posted {
+			continue
+		}
+
+		length := int64(utf8.RuneCountInString(value))
+		switch {
+		case rule.ValueMin != "" && validateCompare(rule.Type, value, rule.ValueMin) < 0:
+			errs[rule.Name] = TypeFieldError{Word: "ejaValidateValueMin", Limit: rule.ValueMin}
+		case rule.ValueMax != "" && validateCompare(rule.Type, value, rule.ValueMax) > 0:
+			errs[rule.Name] = TypeFieldError{Word: "ejaValidateValueMax", Limit: rule.ValueMax}
+		case rule.LengthMin > 0 && length < rule.LengthMin:
+			errs[rule.Name] = TypeFieldError{Word: "ejaValidateLengthMin", Limit: session.String(rule.LengthMin)}
+		case rule.LengthMax > 0 && length > rule.LengthMax:
+			errs[rule.Name] = TypeFieldError{Word: "ejaValidateLengthMax", Limit: session.String(rule.LengthMax)}
+		}
+		if _, ok := errs[rule.Name]; ok {
+			continue
+		}
+
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + rule.Pattern + ")$")
+			if err != nil {
+				return nil, err
+			}
+			if !pattern.MatchString(value) {
+				errs[rule.Name] = TypeFieldError{Word: "ejaValidatePattern"}
+				continue
+			}
+		}
+
+		if rule.ValueUnique {
+			if err := session.TableNameIsValid(tableName); err != nil {
+				return nil, err
+			}
+			if err := session.FieldNameIsValid(rule.Name); err != nil {
+				return nil, err
+			}
+			count, err := session.Value(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s=? AND ejaId<>? %s", tableName, rule.Name, session.trashFilter(tableName, false)), value, ejaId)
+			if err != nil {
+				return nil, err
+			}
+			if session.Number(count) > 0 {
+				errs[rule.Name] = TypeFieldError{Word: "ejaValidateUnique"}
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	return errs, nil
+}
+
+// validateType returns the translation key of the error when value cannot be
+// stored in a field of fieldType without being changed.
+func validateType(fieldType string, value string) string {
+	switch fieldType {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "ejaValidateInteger"
+		}
+	case "decimal":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "ejaValidateDecimal"
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return "ejaValidateBoolean"
+		}
+	case "file":
+		if file, ok := FileParse(value); !ok || !file.Exists() {
+			return "ejaValidateFile"
+		}
+	case "email", "url", "phone":
+		if normalized, ok := ContactNormalize(fieldType, value); !ok || normalized != value {
+			return "ejaValidate" + strings.ToUpper(fieldType[:1]) + fieldType[1:]
+		}
+	case "reference":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "ejaValidateReference"
+		}
+	case "money":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "ejaValidateMoney"
+		}
+	case "json":
+		if !json.Valid([]byte(value)) {
+			return "ejaValidateJson"
+		}
+	case "geo":
+		if _, _, ok := GeoParse(value); !ok {
+			return "ejaValidateGeo"
+		}
+	case "image":
+		if file, ok := ImageParse(value); !ok || !file.Exists() || !file.ThumbFile().Exists() {
+			return "ejaValidateImage"
+		}
+	}
+	return ""
+}
+
+func validateCompare(fieldType string, value string, limit string) int {
+	switch fieldType {
+	case "integer", "decimal", "boolean", "money":
+		a, _ := strconv.ParseFloat(value, 64)
+		b, _ := strconv.ParseFloat(limit, 64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+		return 0
+	case "date", "time", "datetime":
+		return strings.Compare(value, limit)
+	}
+	return 0
+}
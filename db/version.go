@@ -0,0 +1,87 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Version returns a token that changes whenever any value of the stored
+// record does, it is empty when the record cannot be read.
+func (session *TypeSession) Version(ownerId int64, moduleId int64, ejaId int64) (string, error) {
+	row, err := session.Get(ownerId, moduleId, ejaId)
+	if err != nil || len(row) == 0 {
+		return "", err
+	}
+	return rowVersion(row), nil
+}
+
+// Conflicts compares values with the stored record when its version is no
+// longer the one given, returning the stored value of every field that
+// differs from the submitted one. It returns nil when the version still
+// matches or when saving values would not overwrite anything. The record is
+// locked first, called inside a transaction it cannot change before the save.
+func (session *TypeSession) Conflicts(ownerId int64, moduleId int64, ejaId int64, version string, values map[string]string) (map[string]string, error) {
+	if err := session.lock(session.ModuleGetNameById(moduleId), ejaId); err != nil {
+		return nil, err
+	}
+	row, err := session.Get(ownerId, moduleId, ejaId)
+	if err != nil || len(row) == 0 || rowVersion(row) == version {
+		return nil, err
+	}
+
+	conflicts := map[string]string{}
+	for name, value := range values {
+		stored, ok := row[name]
+		if !ok || session.versionSame(session.FieldTypeGet(moduleId, name), value, stored) {
+			continue
+		}
+		conflicts[name] = stored
+	}
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+	return conflicts, nil
+}
+
+func rowVersion(row TypeRow) string {
+	keys := make([]string, 0, len(row))
+	for key := range row {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key + "\x00" + row[key] + "\x00"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// versionSame tells whether a submitted value would leave the stored one
+// unchanged, numbers and dates are compared the way the forms send them.
+func (session *TypeSession) versionSame(fieldType string, value string, stored string) bool {
+	value, stored = strings.TrimSpace(value), strings.TrimSpace(stored)
+	if value == stored {
+		return true
+	}
+	switch fieldType {
+	case "boolean", "integer", "money", "reference":
+		return session.Number(value) == session.Number(stored)
+	case "decimal":
+		return session.Float(value) == session.Float(stored)
+	case "json":
+		return jsonSame(value, stored)
+	case "date":
+		return len(value) >= 10 && len(stored) >= 10 && value[:10] == stored[:10]
+	case "datetime":
+		value = strings.TrimSuffix(strings.Replace(value, " ", "T", 1), "Z")
+		stored = strings.TrimSuffix(strings.Replace(stored, " ", "T", 1), "Z")
+		size := min(len(value), len(stored))
+		return size >= 16 && value[:size] == stored[:size]
+	}
+	return false
+}
@@ -4,6 +4,7 @@ go 1.26.0
 
 require (
 	github.com/go-sql-driver/mysql v1.7.1
+	github.com/lib/pq v1.12.3
 	golang.org/x/crypto v0.49.0
 	golang.org/x/term v0.41.0
 	modernc.org/sqlite v1.44.3
@@ -12,12 +12,16 @@ func Configure() error {
 	flag.BoolVar(&Commands.DbSetup, "db-setup", false, "initialize the database")
 	flag.BoolVar(&Commands.Wizard, "wizard", false, "guided setup")
 
-	flag.StringVar(&Options.DbType, "db-type", "sqlite", "database type: sqlite/mysql")
+	flag.StringVar(&Options.DbType, "db-type", "sqlite", "database type: sqlite/mysql/postgres")
 	flag.StringVar(&Options.DbName, "db-name", "", "database name or filename")
 	flag.StringVar(&Options.DbUser, "db-user", "", "database username")
 	flag.StringVar(&Options.DbPass, "db-pass", "", "database password")
 	flag.StringVar(&Options.DbHost, "db-host", "", "database hostname")
-	flag.IntVar(&Options.DbPort, "db-port", 3306, "database port")
+	flag.IntVar(&Options.DbPort, "db-port", 0, "database port (0 = engine default)")
+	flag.IntVar(&Options.DbMaxOpen, "db-max-open", 0, "maximum open database connections (0 = engine default)")
+	flag.IntVar(&Options.DbMaxIdle, "db-max-idle", 0, "maximum idle database connections (0 = engine default)")
+	flag.IntVar(&Options.DbMaxLifetime, "db-max-lifetime", 0, "maximum database connection lifetime in seconds (0 = engine default)")
+	flag.IntVar(&Options.DbQueryTimeout, "db-query-timeout", 0, "database statement timeout in seconds (0 = no timeout)")
 	flag.StringVar(&Options.DbSetupPath, "db-setup-path", "", "setup files path")
 	flag.StringVar(&Options.DbSetupUser, "db-setup-user", "admin", "setup admin username")
 	flag.StringVar(&Options.DbSetupPass, "db-setup-pass", "", "setup admin password")
@@ -26,6 +30,7 @@ func Configure() error {
 	flag.IntVar(&Options.WebPort, "web-port", 35248, "web listen port")
 	flag.StringVar(&Options.WebTlsPublic, "web-tls-public", "", "web ssl/tls public certificate")
 	flag.StringVar(&Options.WebTlsPrivate, "web-tls-private", "", "web ssl/tls private certificate")
+	flag.StringVar(&Options.FilesPath, "files-path", "files", "attachments storage path")
 	flag.StringVar(&Options.ConfigFile, "config", "", "json config file")
 	flag.StringVar(&Options.Language, "language", "en", "default language code")
 	flag.StringVar(&Options.LogFile, "log-file", "", "log file")
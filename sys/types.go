@@ -7,25 +7,30 @@ import (
 )
 
 type TypeConfig struct {
-	DbType        string `json:"db_type,omitempty"`
-	DbName        string `json:"db_name,omitempty"`
-	DbUser        string `json:"db_user,omitempty"`
-	DbPass        string `json:"db_pass,omitempty"`
-	DbHost        string `json:"db_host,omitempty"`
-	DbPort        int    `json:"db_port,omitempty"`
-	DbSetupUser   string `json:"db_setup_user,omitempty"`
-	DbSetupPass   string `json:"db_setup_pass,omitempty"`
-	DbSetupPath   string `json:"db_setup_path,omitempty"`
-	WebHost       string `json:"web_host,omitempty"`
-	WebPort       int    `json:"web_port,omitempty"`
-	WebPath       string `json:"web_path,omitempty"`
-	WebTlsPublic  string `json:"web_tls_public,omitempty"`
-	WebTlsPrivate string `json:"web_tls_private,omitempty"`
-	ConfigFile    string `json:"config_file,omitempty"`
-	Language      string `json:"language,omitempty"`
-	LogLevel      int    `json:"log_level,omitempty"`
-	LogFile       string `json:"log_file,omitempty"`
-	GoogleSsoId   string `json:"google_sso_id,omitempty"`
+	DbType         string `json:"db_type,omitempty"`
+	DbName         string `json:"db_name,omitempty"`
+	DbUser         string `json:"db_user,omitempty"`
+	DbPass         string `json:"db_pass,omitempty"`
+	DbHost         string `json:"db_host,omitempty"`
+	DbPort         int    `json:"db_port,omitempty"`
+	DbMaxOpen      int    `json:"db_max_open,omitempty"`
+	DbMaxIdle      int    `json:"db_max_idle,omitempty"`
+	DbMaxLifetime  int    `json:"db_max_lifetime,omitempty"`
+	DbQueryTimeout int    `json:"db_query_timeout,omitempty"`
+	DbSetupUser    string `json:"db_setup_user,omitempty"`
+	DbSetupPass    string `json:"db_setup_pass,omitempty"`
+	DbSetupPath    string `json:"db_setup_path,omitempty"`
+	WebHost        string `json:"web_host,omitempty"`
+	WebPort        int    `json:"web_port,omitempty"`
+	WebPath        string `json:"web_path,omitempty"`
+	WebTlsPublic   string `json:"web_tls_public,omitempty"`
+	WebTlsPrivate  string `json:"web_tls_private,omitempty"`
+	FilesPath      string `json:"files_path,omitempty"`
+	ConfigFile     string `json:"config_file,omitempty"`
+	Language       string `json:"language,omitempty"`
+	LogLevel       int    `json:"log_level,omitempty"`
+	LogFile        string `json:"log_file,omitempty"`
+	GoogleSsoId    string `json:"google_sso_id,omitempty"`
 }
 
 type TypeCommand struct {
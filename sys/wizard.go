@@ -72,8 +72,12 @@ func WizardSetup() error {
 		}
 	}
 	//db
-	dbType := WizardPrompt("Choose a database engine between sqlite and mysql (sqlite)")
-	if dbType == "mysql" {
+	dbType := WizardPrompt("Choose a database engine between sqlite, mysql and postgres (sqlite)")
+	if dbType == "mysql" || dbType == "postgres" {
+		defaultPort := "3306"
+		if dbType == "postgres" {
+			defaultPort = "5432"
+		}
 		Options.DbType = dbType
 		Options.DbName = WizardPrompt("Database name")
 		Options.DbUser = WizardPrompt("Database username")
@@ -82,7 +86,7 @@ func WizardSetup() error {
 		if dbHost != "" {
 			Options.DbHost = dbHost
 		}
-		dbPort := WizardPrompt("Database port (3306)")
+		dbPort := WizardPrompt(fmt.Sprintf("Database port (%s)", defaultPort))
 		if dbPort != "" {
 			Options.DbPort, err = strconv.Atoi(dbPort)
 			if err != nil {
@@ -0,0 +1,99 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestAudit tests the change history of a record and restoring values and versions from it
+func TestAudit(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if value, _ := d.Value("SELECT COUNT(*) FROM ejaAudit"); value != "0" {
+		t.Error("Setup should not be audited", value)
+	}
+
+	history := func(id int64, auditId int64, version bool) api.Api {
+		eja := api.Set()
+		eja.ModuleName = "testAudit"
+		eja.Action = "history"
+		eja.Id = id
+		eja.AuditId = auditId
+		eja.AuditVersion = version
+		return runApi(t, session, eja)
+	}
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testAudit", "sqlCreated": "1"}).Id
+	for _, name := range []string{"title", "note"} {
+		saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": name, "type": "text"})
+	}
+
+	id := saveRecord(t, session, "testAudit", 0, map[string]string{"title": "one", "note": "first"}).Id
+	saveRecord(t, session, "testAudit", id, map[string]string{"title": "two", "note": "first"})
+	eja := api.Set()
+	eja.ModuleName = "testAudit"
+	eja.Action = "save"
+	eja.Id = id
+	eja.RemoteIP = "192.0.2.1"
+	eja.Values = map[string]string{"title": "three", "note": "second"}
+	runApi(t, session, eja)
+
+	res := history(id, 0, false)
+	if res.ActionType != "Edit" || res.Values["title"] != "three" {
+		t.Fatal("History should keep the record open", res.ActionType, res.Values)
+	}
+	var puts []db.TypeAudit
+	for _, entry := range res.History {
+		if entry.Action == "put" && entry.Field == "title" {
+			puts = append(puts, entry)
+		}
+	}
+	if len(puts) != 3 || puts[0].OldValue != "two" || puts[0].NewValue != "three" || puts[0].User != "admin" || puts[0].RemoteIp != "192.0.2.1" {
+		t.Fatal("History should list the title changes, most recent first", puts)
+	}
+	if res.History[len(res.History)-1].Action != "new" {
+		t.Error("History should start with the record creation", res.History)
+	}
+
+	res = history(id, puts[0].Id, false)
+	if res.Values["title"] != "two" || res.Values["note"] != "second" {
+		t.Error("Restoring a value should only change that field", res.Values)
+	}
+
+	res = history(id, puts[1].Id, true)
+	if res.Values["title"] != "one" || res.Values["note"] != "first" {
+		t.Error("Restoring a version should bring back every field as it was", res.Values)
+	}
+
+	other := saveRecord(t, session, "testAudit", 0, map[string]string{"title": "other"}).Id
+	res = history(other, puts[0].Id, false)
+	if len(res.Alert) == 0 || res.Values["title"] != "other" {
+		t.Error("Restoring an entry of another record should fail", res.Alert, res.Values)
+	}
+	if value, _ := d.Value("SELECT title FROM testAudit WHERE ejaId=?", id); value != "one" {
+		t.Error("Restoring an entry of another record should not touch it", value)
+	}
+
+	d.LinkAdd(1, moduleId, id, d.ModuleGetIdByName("ejaUsers"), 1)
+	if value, _ := d.Value("SELECT COUNT(*) FROM ejaAudit WHERE ejaModuleId=? AND recordId=? AND action='linkAdd'", moduleId, id); value != "1" {
+		t.Error("Links should be audited", value)
+	}
+
+	if res := searchModule(t, session, "ejaAudit", db.TypeSavedSearchCriteria{Values: map[string]string{"recordId": fmt.Sprint(id)}}); res.SearchCount == 0 {
+		t.Error("Audit log should be searchable", res.SearchCount)
+	}
+}
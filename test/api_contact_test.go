@@ -0,0 +1,32 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestContactFields tests the normalization and validation of email, url and phone fields
+func TestContactFields(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testContact", "sqlCreated": "1"}).Id
+	for i, fieldType := range []string{"email", "url", "phone"} {
+		saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": fieldType, "type": fieldType, "powerList": fmt.Sprint(i + 1), "powerEdit": fmt.Sprint(i + 1)})
+	}
+
+	res := saveRecord(t, session, "testContact", 0, map[string]string{"email": " Ada@Example.COM ", "url": "Example.com/Path?q=1", "phone": "0039 (02) 123-4567"})
+	if res.Values["email"] != "Ada@example.com" || res.Values["url"] != "https://example.com/Path?q=1" || res.Values["phone"] != "+39021234567" {
+		t.Error("Contacts should be normalized on save", res.Values, res.FieldErrors)
+	}
+
+	for field, value := range map[string]string{"email": "ada@", "url": "javascript:alert(1)", "phone": "02 1234567"} {
+		if res := saveRecord(t, session, "testContact", 0, map[string]string{field: value}); res.FieldErrors[field] == "" {
+			t.Error("Invalid value should be refused", field, value)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestFileField tests uploading, downloading, exporting and importing file fields
+func TestFileField(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	filesPath := db.FilesPath
+	db.FilesPath = t.TempDir()
+	defer func() { db.FilesPath = filesPath }()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testFile", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "doc", "type": "file", "powerList": "1", "powerEdit": "1"})
+
+	id := saveRecord(t, session, "testFile", 0, nil).Id
+	res := uploadRecord(t, session, "testFile", id, "doc", "report.pdf", []byte("%PDF-1.4 test"))
+	file, ok := db.FileParse(res.Values["doc"])
+	if !ok || file.Name != "report.pdf" || file.Size != 13 || !file.Exists() {
+		t.Fatal("Upload should be stored with its metadata", res.Values["doc"], res.Alert)
+	}
+	if !strings.HasPrefix(file.Path(), db.FilesPath) {
+		t.Error("Upload should be stored in the files path", file.Path())
+	}
+
+	other := saveRecord(t, session, "testFile", 0, nil).Id
+	res = uploadRecord(t, session, "testFile", other, "doc", "copy.pdf", []byte("%PDF-1.4 test"))
+	if copied, _ := db.FileParse(res.Values["doc"]); copied.Hash != file.Hash || copied.Name != "copy.pdf" {
+		t.Error("Equal content should share the storage", res.Values["doc"])
+	}
+
+	forged := db.TypeFile{Name: "secret", Hash: strings.Repeat("0", 64)}
+	res = saveRecord(t, session, "testFile", other, map[string]string{"doc": forged.String()})
+	if res.FieldErrors["doc"] == "" {
+		t.Error("Only stored files should be accepted", res.FieldErrors)
+	}
+	if res = saveRecord(t, session, "testFile", other, map[string]string{"doc": file.String()}); res.FieldErrors["doc"] == "" {
+		t.Error("Files of other records should not be referenced", res.FieldErrors)
+	}
+	if res = saveRecord(t, session, "testFile", id, map[string]string{"doc": file.String()}); len(res.FieldErrors) > 0 {
+		t.Error("Unchanged files should be kept", res.FieldErrors)
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testFile"
+	eja.Action = "edit"
+	eja.Id = id
+	eja.FieldFile = "doc"
+	if res = runApi(t, session, eja); res.File.Hash != file.Hash {
+		t.Error("Download should return the stored file", res.File)
+	}
+	eja.FieldFile = "ejaLog"
+	if res = runApi(t, session, eja); res.File.Hash != "" || len(res.Alert) == 0 {
+		t.Error("Download should only serve file fields", res.File)
+	}
+
+	res = searchModule(t, session, "testFile", db.TypeSavedSearchCriteria{})
+	if len(res.SearchRows) != 2 || (res.SearchRows[0]["doc"] != "copy.pdf" && res.SearchRows[0]["doc"] != "report.pdf") {
+		t.Error("List should show the file name", res.SearchRows)
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	module, err := d.ModuleExport(moduleId, true)
+	if err != nil || string(module.Files[file.Hash]) != "%PDF-1.4 test" {
+		t.Fatal("Export should carry the attachments", err, module.Files)
+	}
+	data, _ := json.Marshal(module)
+	if err := os.RemoveAll(db.FilesPath); err != nil {
+		t.Fatal(err)
+	}
+	var imported db.TypeModule
+	json.Unmarshal(data, &imported)
+	if err := d.ModuleImport(imported, "testFileCopy"); err != nil {
+		t.Fatal("Import should restore the attachments", err)
+	}
+	if !file.Exists() {
+		t.Error("Imported attachment should be stored")
+	}
+	if value, _ := d.Value("SELECT COUNT(*) FROM testFileCopy WHERE doc<>''"); value != "2" {
+		t.Error("Imported records should keep the file metadata", value)
+	}
+
+	imported.Files[file.Hash] = []byte("tampered")
+	if err := d.ModuleAppend(imported, "testFileCopy"); err == nil {
+		t.Error("Attachments not matching their hash should be refused")
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestSearchFilter tests the structured search filters
+func TestSearchFilter(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	titles := func(res api.Api) string {
+		var result []string
+		for _, row := range res.SearchRows {
+			result = append(result, cmp.Or(row["title"], "-"))
+		}
+		slices.Sort(result)
+		return strings.Join(result, ",")
+	}
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testTickets", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "title", "type": "text", "powerList": "1", "powerSearch": "1"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "status", "type": "select", "value": "open\r\npending\r\nclosed", "powerList": "2", "powerSearch": "2"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "qty", "type": "integer", "powerList": "3", "powerSearch": "3"})
+	for _, ticket := range [][]string{{"alpha", "open", "1"}, {"beta", "pending", "5"}, {"gamma", "closed", "10"}, {"", "closed", "3"}} {
+		saveRecord(t, session, "testTickets", 0, map[string]string{"title": ticket[0], "status": ticket[1], "qty": ticket[2]})
+	}
+
+	tests := []struct {
+		name   string
+		filter db.TypeFilter
+		want   string
+	}{
+		{"in", db.TypeFilter{Field: "status", Op: "in", Values: []string{"open", "pending"}}, "alpha,beta"},
+		{"notIn", db.TypeFilter{Field: "status", Op: "notIn", Values: []string{"closed"}}, "alpha,beta"},
+		{"isNull", db.TypeFilter{Field: "title", Op: "isNull"}, "-"},
+		{"startsWith", db.TypeFilter{Field: "title", Op: "startsWith", Value: "g"}, "gamma"},
+		{"not contains", db.TypeFilter{Field: "title", Op: "contains", Value: "ta", Not: true}, "-,alpha,gamma"},
+		{"or", db.TypeFilter{Logic: "OR", Filters: []db.TypeFilter{
+			{Field: "status", Op: "eq", Value: "open"},
+			{Field: "qty", Op: "between", Values: []string{"4", "6"}},
+		}}, "alpha,beta"},
+		{"nested", db.TypeFilter{Filters: []db.TypeFilter{
+			{Field: "status", Op: "eq", Value: "closed"},
+			{Logic: "OR", Not: true, Filters: []db.TypeFilter{{Field: "qty", Op: "gt", Value: "5"}}},
+		}}, "-"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := searchModule(t, session, "testTickets", db.TypeSavedSearchCriteria{Filter: &test.filter})
+			if len(res.Alert) > 0 {
+				t.Fatal("Filter should be accepted", res.Alert)
+			}
+			if got := titles(res); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "label", "type": "formula", "value": "concat(title)", "powerList": "4"})
+	saveRecord(t, session, "testTickets", 0, map[string]string{"title": "50%_off!", "status": "open", "qty": "1"})
+	for _, test := range []struct {
+		filter db.TypeFilter
+		want   string
+	}{
+		{db.TypeFilter{Field: "title", Op: "contains", Value: "%"}, "50%_off!"},
+		{db.TypeFilter{Field: "title", Op: "contains", Value: "!"}, "50%_off!"},
+		{db.TypeFilter{Field: "title", Op: "startsWith", Value: "5_"}, ""},
+		{db.TypeFilter{Field: "label", Op: "contains", Value: "_"}, "50%_off!"},
+		{db.TypeFilter{Field: "label", Op: "in", Values: []string{"alpha", "5"}}, "alpha"},
+	} {
+		if got := titles(searchModule(t, session, "testTickets", db.TypeSavedSearchCriteria{Filter: &test.filter})); got != test.want {
+			t.Errorf("%v: got %q, want %q", test.filter, got, test.want)
+		}
+	}
+
+	for _, filter := range []db.TypeFilter{
+		{Field: "title; DROP TABLE testTickets", Op: "eq", Value: "x"},
+		{Field: "missing", Op: "eq", Value: "x"},
+		{Field: "title", Op: "like", Value: "x"},
+		{Field: "qty", Op: "between", Values: []string{"1"}},
+	} {
+		if res := searchModule(t, session, "testTickets", db.TypeSavedSearchCriteria{Filter: &filter}); len(res.Alert) == 0 || res.SearchCount != 0 {
+			t.Error("Invalid filters should alert and match nothing", filter, res.Alert, res.SearchCount)
+		}
+	}
+}
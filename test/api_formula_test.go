@@ -0,0 +1,79 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestFormula tests computed fields in records, lists, searches and their validation
+func TestFormula(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testFormula", "sqlCreated": "1"}).Id
+	field := func(name string, fieldType string, value string, powerList string) api.Api {
+		return saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": name, "type": fieldType, "value": value, "powerList": powerList, "powerEdit": "1"})
+	}
+	field("qty", "integer", "", "1")
+	field("price", "decimal", "", "2")
+	field("first", "text", "", "0")
+	field("last", "text", "", "0")
+	field("born", "date", "", "0")
+	field("total", "formula", "qty * price", "3")
+	field("fullName", "formula", "concat(first, ' ', upper(last))", "4")
+	field("half", "formula", "round(total / 2, 2)", "5")
+	field("age", "formula", "years(born)", "0")
+
+	for _, formula := range []string{"qty * missing", "loop + 1", "qty; DROP TABLE testFormula", "concat('a\\', qty)", "unknown(qty)", "(qty"} {
+		res := field("loop", "formula", formula, "0")
+		if len(res.FieldErrors) == 0 {
+			t.Error("Formula should be rejected", formula)
+		}
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if check, _ := d.FieldExists("testFormula", "total"); check {
+		t.Error("Formula fields should not have a column")
+	}
+
+	born := time.Now().AddDate(-30, 0, -1).Format("2006-01-02")
+	res := saveRecord(t, session, "testFormula", 0, map[string]string{"qty": "3", "price": "2.5", "first": "Ada", "last": "Lovelace", "born": born})
+	if value := fieldValue(res.Fields, "total"); value != "7.5" {
+		t.Error("Formula should be computed on the record", value)
+	}
+	if value := fieldValue(res.Fields, "fullName"); value != "Ada LOVELACE" {
+		t.Error("Text formula", value)
+	}
+	if value := fieldValue(res.Fields, "age"); value != "30" {
+		t.Error("Date formula", value)
+	}
+	saveRecord(t, session, "testFormula", 0, map[string]string{"qty": "10", "price": "1"})
+	saveRecord(t, session, "testFormula", 0, map[string]string{"qty": "1", "price": "0.5"})
+
+	res = searchModule(t, session, "testFormula", db.TypeSavedSearchCriteria{Values: map[string]string{"total.start": "5"}})
+	if res.SearchCount != 2 {
+		t.Error("Formula should be searchable", res.SearchCount, res.SearchRows)
+	}
+
+	res = searchModule(t, session, "testFormula", db.TypeSavedSearchCriteria{Values: map[string]string{"total": "7.5"}})
+	if res.SearchCount != 1 {
+		t.Error("Formula should match its text", res.SearchCount, res.SearchRows)
+	}
+
+	res = searchModule(t, session, "testFormula", db.TypeSavedSearchCriteria{SearchOrder: map[string]string{"total": "DESC"}})
+	if len(res.SearchRows) != 3 || res.SearchRows[0]["total"] != "10" || res.SearchRows[1]["total"] != "7.5" || res.SearchRows[2]["half"] != "0.25" {
+		t.Error("Formula should be listed and sorted", res.SearchRows)
+	}
+}
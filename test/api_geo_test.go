@@ -0,0 +1,73 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestGeoField tests validation, near and box searches and the GeoJSON output of geo fields
+func TestGeoField(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testGeo", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "city", "type": "text", "powerList": "1", "powerSearch": "1", "powerEdit": "1"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "site", "type": "geo", "powerList": "2", "powerSearch": "2", "powerEdit": "2"})
+
+	milan := saveRecord(t, session, "testGeo", 0, map[string]string{"city": "Milan", "site": "45.4642,9.19"}).Id
+	saveRecord(t, session, "testGeo", 0, map[string]string{"city": "Turin", "site": "45.0703, 7.6869"})
+	saveRecord(t, session, "testGeo", 0, map[string]string{"city": "Rome", "site": "41.9028,12.4964"})
+	saveRecord(t, session, "testGeo", 0, map[string]string{"city": "Nowhere"})
+
+	if res := saveRecord(t, session, "testGeo", 0, map[string]string{"city": "Pole", "site": "91,0"}); res.FieldErrors["site"] == "" {
+		t.Error("Latitude out of range should be refused", res.FieldErrors)
+	}
+	if res := saveRecord(t, session, "testGeo", 0, map[string]string{"city": "Text", "site": "here"}); res.FieldErrors["site"] == "" {
+		t.Error("Values that are not coordinates should be refused", res.FieldErrors)
+	}
+
+	res := searchModule(t, session, "testGeo", db.TypeSavedSearchCriteria{
+		Values:      map[string]string{"site.near": "45.4642,9.19,150"},
+		SearchOrder: map[string]string{db.SearchDistance: "DESC"},
+	})
+	if len(res.SearchRows) != 2 || res.SearchRows[0]["city"] != "Turin" || res.SearchRows[1]["city"] != "Milan" {
+		t.Fatal("Near search should match the points within the radius sorted by distance", res.SearchRows)
+	}
+	if distance, _ := strconv.ParseFloat(res.SearchRows[0][db.SearchDistance], 64); distance < 120 || distance > 130 {
+		t.Error("Distance should be in kilometers", res.SearchRows[0])
+	}
+
+	res = searchModule(t, session, "testGeo", db.TypeSavedSearchCriteria{Values: map[string]string{"site.box": "41,12,42,13"}})
+	if len(res.SearchRows) != 1 || res.SearchRows[0]["city"] != "Rome" {
+		t.Error("Box search should match the points inside", res.SearchRows)
+	}
+	res = searchModule(t, session, "testGeo", db.TypeSavedSearchCriteria{Values: map[string]string{"site.box": "44,170,46,10"}})
+	if len(res.SearchRows) != 2 {
+		t.Error("Box search should handle boxes crossing the antimeridian", res.SearchRows)
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testGeo"
+	eja.Action = "edit"
+	eja.Id = milan
+	eja.TypedValues = true
+	data, _ := json.Marshal(runApi(t, session, eja))
+	var out struct {
+		Values map[string]any
+	}
+	json.Unmarshal(data, &out)
+	point, _ := out.Values["site"].(map[string]any)
+	coordinates, _ := point["coordinates"].([]any)
+	if point["type"] != "Point" || len(coordinates) != 2 || coordinates[0] != 9.19 || coordinates[1] != 45.4642 {
+		t.Error("Typed output should emit GeoJSON points", out.Values["site"])
+	}
+}
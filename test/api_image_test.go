@@ -0,0 +1,102 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestImageField tests image uploads with their thumbnails, the removal of EXIF data and the rejection of invalid images
+func TestImageField(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	filesPath := db.FilesPath
+	db.FilesPath = t.TempDir()
+	defer func() { db.FilesPath = filesPath }()
+
+	session := getAuthenticatedSession(t)
+
+	picture := image.NewRGBA(image.Rect(0, 0, 400, 300))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			picture.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, picture, nil); err != nil {
+		t.Fatal(err)
+	}
+	exif := append([]byte{0xFF, 0xE1, 0x00, 0x10}, []byte("Exif\x00\x00GPS-secret")...)
+	photo := append(append([]byte{}, encoded.Bytes()[:2]...), append(exif, encoded.Bytes()[2:]...)...)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testImage", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "photo", "type": "image", "powerList": "1", "powerEdit": "1"})
+
+	id := saveRecord(t, session, "testImage", 0, nil).Id
+	res := uploadRecord(t, session, "testImage", id, "photo", "holiday.jpg", photo)
+	file, ok := db.ImageParse(res.Values["photo"])
+	if !ok || file.Mime != "image/jpeg" || !file.Exists() || !file.ThumbFile().Exists() {
+		t.Fatal("Image should be stored with its thumbnail", res.Values["photo"], res.Alert)
+	}
+	stored, _ := os.ReadFile(file.Path())
+	if bytes.Contains(stored, []byte("Exif")) || bytes.Contains(stored, []byte("GPS-secret")) {
+		t.Error("Stored image should not carry EXIF data")
+	}
+	thumbData, _ := os.ReadFile(file.ThumbFile().Path())
+	if thumb, _, err := image.DecodeConfig(bytes.NewReader(thumbData)); err != nil || thumb.Width != 200 || thumb.Height != 150 {
+		t.Error("Thumbnail should be resized keeping the aspect ratio", thumb, err)
+	}
+
+	res = uploadRecord(t, session, "testImage", id, "photo", "fake.jpg", []byte("<script>alert(1)</script>"))
+	if res.FieldErrors["photo"] == "" {
+		t.Error("Uploads that are not images should be refused", res.FieldErrors)
+	}
+	forged := db.TypeFile{Name: "x.txt", Mime: "text/plain", Hash: file.Hash, Thumb: file.Thumb}
+	res = saveRecord(t, session, "testImage", id, map[string]string{"photo": forged.String()})
+	if res.FieldErrors["photo"] == "" {
+		t.Error("Only stored images should be accepted", res.FieldErrors)
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testImage"
+	eja.Action = "edit"
+	eja.Id = id
+	res = runApi(t, session, eja)
+	for _, field := range res.Fields {
+		if field.Name == "photo" && (!strings.Contains(field.Preview, "ejaThumb=1") || field.Url == "" || strings.Contains(field.Url, "ejaThumb")) {
+			t.Error("Edit should return the preview and full size addresses", field.Preview, field.Url)
+		}
+	}
+
+	res = searchModule(t, session, "testImage", db.TypeSavedSearchCriteria{})
+	if len(res.SearchRows) != 1 || res.SearchRows[0]["photo"] != fmt.Sprintf("?ejaModuleId=%d&ejaId=%d&ejaFile=photo&ejaThumb=1", moduleId, id) {
+		t.Error("List should return the thumbnail address", res.SearchRows)
+	}
+
+	eja.FieldFile = "photo"
+	eja.FileThumb = true
+	if res = runApi(t, session, eja); res.File.Hash != file.Thumb {
+		t.Error("Thumbnail download should return the thumbnail", res.File)
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	module, err := d.ModuleExport(moduleId, true)
+	if err != nil || len(module.Files[file.Hash]) == 0 || len(module.Files[file.Thumb]) == 0 {
+		t.Error("Export should carry the image and its thumbnail", err, len(module.Files))
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/eja/tibula/db"
+)
+
+// TestFieldIndex tests the sqlIndex field option and the built-in indexes
+func TestFieldIndex(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	indexSql := func(name string) string {
+		value, _ := d.Value("SELECT sql FROM sqlite_master WHERE type='index' AND name=?", name)
+		return value
+	}
+
+	if indexSql(db.IndexName("ejaLinks", "srcModuleId", "srcFieldId", "dstModuleId", "dstFieldId")) == "" {
+		t.Error("Setup should index ejaLinks")
+	}
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testIndex", "sqlCreated": "1"}).Id
+	fieldId := saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "code", "type": "text", "sqlIndex": "unique"}).Id
+
+	if !strings.Contains(indexSql(db.IndexName("testIndex", "code")), "UNIQUE") {
+		t.Fatal("Unique index not created")
+	}
+	saveRecord(t, session, "testIndex", 0, map[string]string{"code": "A1"})
+	if _, err := d.Run("INSERT INTO testIndex (ejaOwner, code) VALUES (1, 'A1')"); err == nil {
+		t.Error("Unique index should reject duplicates")
+	}
+
+	module, err := d.ModuleExport(moduleId, false)
+	if err != nil || len(module.Field) != 1 || module.Field[0].SqlIndex != "unique" {
+		t.Error("Export should carry the index option", module.Field, err)
+	}
+
+	saveRecord(t, session, "ejaFields", fieldId, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "serial", "type": "text", "sqlIndex": "index"})
+	if indexSql(db.IndexName("testIndex", "code")) != "" {
+		t.Error("Old index should be dropped")
+	}
+	if sql := indexSql(db.IndexName("testIndex", "serial")); sql == "" || strings.Contains(sql, "UNIQUE") {
+		t.Error("Plain index should follow the renamed field", sql)
+	}
+
+	saveRecord(t, session, "ejaFields", fieldId, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "serial", "type": "text", "sqlIndex": ""})
+	if indexSql(db.IndexName("testIndex", "serial")) != "" {
+		t.Error("Index should be dropped when the option is cleared")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestDeleteRules tests the onDelete rules of sub-module links
+func TestDeleteRules(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	parentsId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testParents", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(parentsId), "name": "title", "type": "text", "powerList": "1"})
+	modules := map[string]int64{}
+	for _, name := range []string{"testChildren", "testNotes"} {
+		modules[name] = saveRecord(t, session, "ejaModules", 0, map[string]string{"name": name, "sqlCreated": "1"}).Id
+		saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(modules[name]), "name": "parentId", "type": "integer", "powerList": "1"})
+	}
+	childrenLink := saveRecord(t, session, "ejaModuleLinks", 0, map[string]string{"dstModuleId": fmt.Sprint(parentsId), "srcModuleId": fmt.Sprint(modules["testChildren"]), "srcFieldName": "parentId"}).Id
+	saveRecord(t, session, "ejaModuleLinks", 0, map[string]string{"dstModuleId": fmt.Sprint(parentsId), "srcModuleId": fmt.Sprint(modules["testNotes"]), "srcFieldName": "parentId", "onDelete": "setNull"})
+
+	parent := saveRecord(t, session, "testParents", 0, map[string]string{"title": "one"}).Id
+	for range 2 {
+		saveRecord(t, session, "testChildren", 0, map[string]string{"parentId": fmt.Sprint(parent)})
+	}
+	note := saveRecord(t, session, "testNotes", 0, map[string]string{"parentId": fmt.Sprint(parent)}).Id
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	count := func(query string, args ...any) string {
+		value, err := d.Value(query, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return value
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testParents"
+	eja.Action = "delete"
+	eja.Id = parent
+	res := runApi(t, session, eja)
+	if len(res.Alert) == 0 || !strings.HasSuffix(res.Alert[0], ": 2") {
+		t.Error("Restricted delete should alert with the dependent count", res.Alert)
+	}
+	if count("SELECT COUNT(*) FROM testParents WHERE ejaId=?", parent) != "1" || count("SELECT COUNT(*) FROM testNotes WHERE parentId=?", parent) != "1" {
+		t.Fatal("Restricted delete should leave everything in place")
+	}
+
+	if err := d.Put(1, d.ModuleGetIdByName("ejaModuleLinks"), childrenLink, "onDelete", "cascade"); err != nil {
+		t.Fatal(err)
+	}
+	res = runApi(t, session, eja)
+	if len(res.Alert) > 0 {
+		t.Error("Cascade delete should succeed", res.Alert)
+	}
+	if count("SELECT COUNT(*) FROM testParents WHERE ejaId=?", parent) != "0" || count("SELECT COUNT(*) FROM testChildren") != "0" {
+		t.Error("Cascade should delete the parent and its children")
+	}
+	if count("SELECT COUNT(*) FROM testNotes WHERE ejaId=? AND parentId IS NULL", note) != "1" {
+		t.Error("Set null should keep the note and clear its parent")
+	}
+	if count("SELECT COUNT(*) FROM ejaAudit WHERE ejaModuleId=? AND action='del'", modules["testChildren"]) != "2" {
+		t.Error("Cascaded deletions should be audited")
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestJsonField tests validation, path searches and the embedded output of json fields
+func TestJsonField(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testJson", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "name", "type": "text", "powerList": "1", "powerSearch": "1", "powerEdit": "1"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "payload", "type": "json", "powerList": "2", "powerSearch": "2", "powerEdit": "2"})
+
+	first := saveRecord(t, session, "testJson", 0, map[string]string{"name": "first", "payload": `{"customer": {"id": 7, "name": "Ada"}, "items": [{"price": 10.5}]}`}).Id
+	saveRecord(t, session, "testJson", 0, map[string]string{"name": "second", "payload": `{"customer": {"id": 12, "name": "Bob"}, "items": [{"price": 3}]}`})
+	saveRecord(t, session, "testJson", 0, map[string]string{"name": "empty"})
+
+	if res := saveRecord(t, session, "testJson", 0, map[string]string{"name": "broken", "payload": `{"customer": `}); res.FieldErrors["payload"] == "" {
+		t.Error("Invalid documents should be refused", res.FieldErrors)
+	}
+
+	search := db.TypeSavedSearchCriteria{Values: map[string]string{"payload.$.customer.id": "7"}}
+	if res := searchModule(t, session, "testJson", search); len(res.SearchRows) != 1 || res.SearchRows[0]["name"] != "first" {
+		t.Error("Path equality on numbers", res.SearchRows)
+	}
+	search.Values = map[string]string{"payload.$.customer.name": "Bob"}
+	if res := searchModule(t, session, "testJson", search); len(res.SearchRows) != 1 || res.SearchRows[0]["name"] != "second" {
+		t.Error("Path equality on text", res.SearchRows)
+	}
+	search.Values = map[string]string{"payload.$.items[0].price.start": "5"}
+	if res := searchModule(t, session, "testJson", search); len(res.SearchRows) != 1 || res.SearchRows[0]["name"] != "first" {
+		t.Error("Path range with array index", res.SearchRows)
+	}
+	search.Values = map[string]string{"payload.$.customer.id.start": "1", "payload.$.customer.id.stop": "20"}
+	if res := searchModule(t, session, "testJson", search); len(res.SearchRows) != 2 {
+		t.Error("Path range", res.SearchRows)
+	}
+	all := searchModule(t, session, "testJson", db.TypeSavedSearchCriteria{})
+	search.Values = map[string]string{"payload.$.customer') OR 1=1 --": "1"}
+	if res := searchModule(t, session, "testJson", search); len(res.SearchRows) != len(all.SearchRows) {
+		t.Error("Invalid paths should be ignored", res.SearchRows)
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testJson"
+	eja.Action = "edit"
+	eja.Id = first
+	data, _ := json.Marshal(runApi(t, session, eja))
+	var out struct {
+		Values map[string]any
+	}
+	json.Unmarshal(data, &out)
+	payload, _ := out.Values["payload"].(map[string]any)
+	if customer, _ := payload["customer"].(map[string]any); customer["name"] != "Ada" {
+		t.Error("Json fields should be embedded in the API output", out.Values["payload"])
+	}
+
+	data, _ = json.Marshal(all)
+	var rows struct {
+		SearchRows []map[string]any
+	}
+	json.Unmarshal(data, &rows)
+	embedded := 0
+	for _, row := range rows.SearchRows {
+		if _, ok := row["payload"].(map[string]any); ok {
+			embedded++
+		}
+	}
+	if embedded != 2 {
+		t.Error("Json fields should be embedded in the list", rows.SearchRows)
+	}
+}
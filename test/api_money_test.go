@@ -0,0 +1,73 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestMoneyField tests exact storage, locale parsing and formatting and range searches of money fields
+func TestMoneyField(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Run("UPDATE ejaUsers SET ejaLanguage='it'"); err != nil {
+		t.Fatal(err)
+	}
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testMoney", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "amount", "type": "money", "value": "EUR", "powerList": "1", "powerSearch": "1", "powerEdit": "1"})
+
+	res := saveRecord(t, session, "testMoney", 0, map[string]string{"amount": "1.234,56"})
+	if res.Values["amount"] != "1234.56" || fieldValue(res.Fields, "amount") != "1.234,56 EUR" {
+		t.Error("Amounts should be parsed and shown in the user locale", res.Values["amount"], fieldValue(res.Fields, "amount"), res.FieldErrors)
+	}
+	id := res.Id
+	if value, _ := d.Value("SELECT amount FROM testMoney WHERE ejaId=?", id); value != "123456" {
+		t.Error("Amounts should be stored in minor units", value)
+	}
+	saveRecord(t, session, "testMoney", 0, map[string]string{"amount": "0.1"})
+	saveRecord(t, session, "testMoney", 0, map[string]string{"amount": "0,2 EUR"})
+	if value, _ := d.Value("SELECT SUM(amount) FROM testMoney WHERE amount < 100"); value != "30" {
+		t.Error("Sums should not drift", value)
+	}
+
+	if res := saveRecord(t, session, "testMoney", 0, map[string]string{"amount": "12,345"}); res.FieldErrors["amount"] == "" {
+		t.Error("Amounts with more decimals than the currency should be refused", res.FieldErrors)
+	}
+	if res := saveRecord(t, session, "testMoney", 0, map[string]string{"amount": "ten"}); res.FieldErrors["amount"] == "" {
+		t.Error("Amounts that are not numbers should be refused", res.FieldErrors)
+	}
+
+	res = searchModule(t, session, "testMoney", db.TypeSavedSearchCriteria{Values: map[string]string{"amount.start": "1.000,00"}})
+	if len(res.SearchRows) != 1 || res.SearchRows[0]["amount"] != "1.234,56 EUR" {
+		t.Error("Range search should use the locale and the list should format amounts", res.SearchRows)
+	}
+	res = searchModule(t, session, "testMoney", db.TypeSavedSearchCriteria{Values: map[string]string{"amount.start": "0.15", "amount.stop": "1"}})
+	if len(res.SearchRows) != 1 {
+		t.Error("Range search with plain numbers", res.SearchRows)
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testMoney"
+	eja.Action = "edit"
+	eja.Id = id
+	eja.TypedValues = true
+	data, _ := json.Marshal(runApi(t, session, eja))
+	if !strings.Contains(string(data), `"amount":1234.56`) {
+		t.Error("Typed output should emit the exact amount", string(data))
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/db"
+)
+
+// TestReferenceField tests options, labels, searches and export of reference fields
+func TestReferenceField(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	customersId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testCustomers", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(customersId), "name": "name", "type": "text", "powerList": "1", "powerEdit": "1"})
+	ordersId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testOrders", "sqlCreated": "1"}).Id
+	if res := saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(ordersId), "name": "customer", "type": "reference", "value": "testCustomers.missing", "powerList": "1"}); res.FieldErrors["value"] == "" {
+		t.Error("Reference to a missing field should be refused", res.FieldErrors)
+	}
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(ordersId), "name": "customer", "type": "reference", "value": "testCustomers.name", "powerList": "1", "powerSearch": "1", "powerEdit": "1"})
+
+	ada := saveRecord(t, session, "testCustomers", 0, map[string]string{"name": "Ada"}).Id
+	bob := saveRecord(t, session, "testCustomers", 0, map[string]string{"name": "Bob"}).Id
+
+	res := saveRecord(t, session, "testOrders", 0, map[string]string{"customer": fmt.Sprint(ada)})
+	if len(res.FieldErrors) > 0 {
+		t.Fatal("Reference should be saved", res.FieldErrors)
+	}
+	for _, field := range res.Fields {
+		if field.Name == "customer" && (len(field.Options) != 2 || field.Options[0].Value != "Ada") {
+			t.Error("Options should list the target records by label", field.Options)
+		}
+	}
+	if res := saveRecord(t, session, "testOrders", 0, map[string]string{"customer": "9999"}); res.FieldErrors["customer"] == "" {
+		t.Error("References to missing records should be refused", res.FieldErrors)
+	}
+	saveRecord(t, session, "testOrders", 0, map[string]string{"customer": fmt.Sprint(bob)})
+
+	res = searchModule(t, session, "testOrders", db.TypeSavedSearchCriteria{Values: map[string]string{"customer": "Bob"}})
+	if len(res.SearchRows) != 1 || res.SearchRows[0]["customer"] != "Bob" {
+		t.Error("Search should filter by the target label and the list should show it", res.SearchRows)
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Trash(1, customersId, bob); err != nil {
+		t.Fatal(err)
+	}
+	if options := d.ReferenceOptions(1, "testCustomers.name"); len(options) != 1 {
+		t.Error("Options should only list the readable records", options)
+	}
+
+	module, err := d.ModuleExport(ordersId, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := 0
+	for _, data := range module.Data {
+		if data["customer.testCustomers"] == "Ada" || data["customer.testCustomers"] == "Bob" {
+			exported++
+		}
+		data["customer"] = "9999"
+	}
+	if exported != 2 {
+		t.Error("Export should carry the target labels", module.Data)
+	}
+	if err := d.ModuleImport(module, "testOrdersCopy"); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := d.Value("SELECT COUNT(*) FROM testOrdersCopy WHERE customer IN (?, ?)", ada, bob); value != "2" {
+		t.Error("Import should resolve the labels to the target records", value)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/eja/tibula/api"
+)
+
+// TestTypedValues tests the typed JSON output against the default all-strings one
+func TestTypedValues(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	decode := func(res api.Api) map[string]any {
+		var out map[string]any
+		data, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "ejaModules"
+	eja.Action = "search"
+	res := runApi(t, session, eja)
+	if len(res.SearchRows) == 0 {
+		t.Fatal("Search failed")
+	}
+	row := decode(res)["SearchRows"].([]any)[0].(map[string]any)
+	if _, ok := row["power"].(string); !ok {
+		t.Error("Default output should keep strings", row)
+	}
+
+	eja.TypedValues = true
+	res = runApi(t, session, eja)
+	row = decode(res)["SearchRows"].([]any)[0].(map[string]any)
+	if _, ok := row["power"].(float64); !ok {
+		t.Error("Typed output should emit numbers", row)
+	}
+	if _, ok := row["ejaId"].(float64); !ok {
+		t.Error("Typed output should emit numeric ids", row)
+	}
+
+	eja = api.Set()
+	eja.ModuleName = "ejaModules"
+	eja.Action = "edit"
+	eja.Id = res.SearchResult.Record(0)["ejaId"].(int64)
+	eja.TypedValues = true
+	values := decode(runApi(t, session, eja))["Values"].(map[string]any)
+	if _, ok := values["sqlCreated"].(bool); !ok {
+		t.Error("Boolean fields should be emitted as booleans", values)
+	}
+	if _, ok := values["searchLimit"].(float64); !ok {
+		t.Error("Integer fields should be emitted as numbers", values)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestSavedSearches tests saving, applying, sharing and pinning searches
+func TestSavedSearches(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testDocs", "sqlCreated": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "title", "type": "text", "powerList": "1", "powerSearch": "1"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "status", "type": "text", "powerList": "2", "powerSearch": "2"})
+	for _, doc := range [][]string{{"b", "open"}, {"a", "open"}, {"c", "closed"}} {
+		saveRecord(t, session, "testDocs", 0, map[string]string{"title": doc[0], "status": doc[1]})
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testDocs"
+	eja.Action = "search"
+	eja.Values = map[string]string{"status": "open"}
+	eja.SearchOrder = map[string]string{"title": "ASC"}
+	eja.SearchName = "Open docs"
+	res := runApi(t, session, eja)
+	if res.SearchId < 1 || len(res.Info) == 0 {
+		t.Fatal("Search should be saved", res.Info, res.Alert)
+	}
+	searchId := res.SearchId
+
+	// logging out wipes the search state of the session
+	eja = api.Set()
+	eja.Session = session
+	eja.Action = "logout"
+	api.Run(eja, true)
+	session = getAuthenticatedSession(t)
+
+	eja = api.Set()
+	eja.ModuleName = "testDocs"
+	eja.SearchId = searchId
+	res = runApi(t, session, eja)
+	if res.SearchCount != 2 || len(res.SearchRows) != 2 || res.SearchRows[0]["title"] != "a" {
+		t.Error("Saved search should be applied with its order", res.SearchCount, res.SearchRows)
+	}
+	if len(res.Searches) != 1 || res.Searches[0].Name != "Open docs" {
+		t.Error("List should offer the saved searches of the module", res.Searches)
+	}
+
+	eja = api.Set()
+	eja.ModuleName = "ejaUsers"
+	eja.SearchId = searchId
+	if res = runApi(t, session, eja); len(res.Alert) == 0 {
+		t.Error("Saved search should only apply to its module")
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	searchesId := d.ModuleGetIdByName("ejaSearches")
+
+	if err := d.Put(1, searchesId, searchId, "pinned", 1); err != nil {
+		t.Fatal(err)
+	}
+	pinned := false
+	for _, item := range runApi(t, session, api.Set()).Tree {
+		if item.SearchId == searchId && item.Id == moduleId && item.Label == "Open docs" {
+			pinned = true
+		}
+	}
+	if !pinned {
+		t.Error("Pinned search should be in the module tree")
+	}
+
+	userId, _ := d.New(1, d.ModuleGetIdByName("ejaUsers"))
+	groupId, _ := d.New(1, d.ModuleGetIdByName("ejaGroups"))
+	if err := d.LinkAdd(1, d.ModuleGetIdByName("ejaGroups"), groupId, d.ModuleGetIdByName("ejaUsers"), userId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.SavedSearchGet(userId, searchId); err == nil {
+		t.Error("Private search should not be visible to other users")
+	}
+	if _, err := d.SavedSearchSave(userId, moduleId, "Open docs", db.TypeSavedSearchCriteria{}); err == nil {
+		t.Error("Searches should only be saved on modules the user can search")
+	}
+
+	res = saveRecord(t, session, "ejaSearches", searchId, map[string]string{"ejaGroupId": fmt.Sprint(groupId)})
+	if len(res.Alert) == 0 {
+		t.Error("Searches should only be shared with the groups of their owner")
+	}
+	if value, _ := d.Value("SELECT ejaGroupId FROM ejaSearches WHERE ejaId=?", searchId); d.Number(value) != 0 {
+		t.Error("Refused share should not be stored", value)
+	}
+
+	if err := d.LinkAdd(1, d.ModuleGetIdByName("ejaGroups"), groupId, d.ModuleGetIdByName("ejaUsers"), 1); err != nil {
+		t.Fatal(err)
+	}
+	res = saveRecord(t, session, "ejaSearches", searchId, map[string]string{"ejaGroupId": fmt.Sprint(groupId)})
+	if len(res.Alert) > 0 {
+		t.Fatal("Search should be shared with a group of its owner", res.Alert)
+	}
+	if search, err := d.SavedSearchGet(userId, searchId); err != nil || search.Criteria.Values["status"] != "open" {
+		t.Error("Search shared with a group should be visible to its members", search, err)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestSchemaSync tests that field edits and removals reach the table columns
+func TestSchemaSync(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := fmt.Sprint(saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testSchema", "sqlCreated": "1"}).Id)
+	fieldId := saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": moduleId, "name": "amount", "type": "text"}).Id
+	recordId := saveRecord(t, session, "testSchema", 0, map[string]string{"amount": "42"}).Id
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	exists := func(field string) bool {
+		check, err := d.FieldExists("testSchema", field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return check
+	}
+
+	t.Run("Rename", func(t *testing.T) {
+		saveRecord(t, session, "ejaFields", fieldId, map[string]string{"ejaModuleId": moduleId, "name": "total", "type": "text"})
+		if exists("amount") || !exists("total") {
+			t.Fatal("Column was not renamed")
+		}
+		if value, _ := d.Value("SELECT total FROM testSchema WHERE ejaId=?", recordId); value != "42" {
+			t.Error("Rename lost the data", value)
+		}
+	})
+
+	t.Run("Retype_Needs_Confirm", func(t *testing.T) {
+		values := map[string]string{"ejaModuleId": moduleId, "name": "total", "type": "integer"}
+		res := saveRecord(t, session, "ejaFields", fieldId, values)
+		if len(res.Confirmations) == 0 || len(res.Alert) == 0 {
+			t.Fatal("Destructive change should ask for confirmation", res.Alert)
+		}
+		if fieldType, _ := d.Value("SELECT type FROM ejaFields WHERE ejaId=?", fieldId); fieldType != "text" {
+			t.Error("Unconfirmed change should not be stored", fieldType)
+		}
+
+		eja := api.Set()
+		eja.ModuleName = "ejaFields"
+		eja.Id = fieldId
+		eja.Action = "save"
+		eja.Confirm = true
+		eja.Values = values
+		runApi(t, session, eja)
+		columnType, _ := d.Value("SELECT type FROM pragma_table_info('testSchema') WHERE name='total'")
+		if columnType != "INTEGER" {
+			t.Error("Column was not retyped", columnType)
+		}
+		if value, _ := d.Value("SELECT typeof(total) || total FROM testSchema WHERE ejaId=?", recordId); value != "integer42" {
+			t.Error("Retype lost the data", value)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		eja := api.Set()
+		eja.ModuleName = "ejaFields"
+		eja.Action = "delete"
+		eja.IdList = []int64{fieldId}
+		res := runApi(t, session, eja)
+		if len(res.Confirmations) == 0 || !exists("total") {
+			t.Fatal("Removing a field should ask for confirmation")
+		}
+
+		eja.Confirm = true
+		runApi(t, session, eja)
+		if exists("total") {
+			t.Error("Column was not dropped")
+		}
+		if value, _ := d.Value("SELECT COUNT(*) FROM testSchema"); value != "1" {
+			t.Error("Rows should survive the rebuild", value)
+		}
+	})
+}
@@ -3,10 +3,13 @@
 package test
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"mime/multipart"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/eja/tibula/api"
@@ -68,6 +71,84 @@ func getAuthenticatedSession(t *testing.T) string {
 	return res.Session
 }
 
+// runApi runs eja within session and stops the test when the call fails
+func runApi(t *testing.T, session string, eja api.Api) api.Api {
+	t.Helper()
+	eja.Session = session
+	res, err := api.Run(eja, true)
+	if err != nil {
+		t.Fatal(eja.Action, err)
+	}
+	return res
+}
+
+// saveRecord saves values on the record id of moduleName, creating the record first when id is 0
+func saveRecord(t *testing.T, session string, moduleName string, id int64, values map[string]string) api.Api {
+	t.Helper()
+	if id == 0 {
+		eja := api.Set()
+		eja.ModuleName = moduleName
+		eja.Action = "new"
+		id = runApi(t, session, eja).Id
+	}
+	eja := api.Set()
+	eja.ModuleName = moduleName
+	eja.Id = id
+	eja.Action = "save"
+	for key, value := range values {
+		eja.Values[key] = value
+	}
+	return runApi(t, session, eja)
+}
+
+// searchModule searches moduleName with criteria, starting from a clean search
+func searchModule(t *testing.T, session string, moduleName string, criteria db.TypeSavedSearchCriteria) api.Api {
+	t.Helper()
+	eja := api.Set()
+	eja.ModuleName = moduleName
+	eja.Action = "search"
+	eja.SearchLinkClean = true
+	for key, value := range criteria.Values {
+		eja.Values[key] = value
+	}
+	if criteria.SearchOrder != nil {
+		eja.SearchOrder = criteria.SearchOrder
+	}
+	eja.Filter = criteria.Filter
+	eja.SearchLimit = criteria.SearchLimit
+	return runApi(t, session, eja)
+}
+
+// uploadRecord saves content as the upload of field on the record id of moduleName
+func uploadRecord(t *testing.T, session string, moduleName string, id int64, field string, name string, content []byte) api.Api {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("ejaFile["+field+"]", name)
+	part.Write(content)
+	writer.Close()
+	form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eja := api.Set()
+	eja.ModuleName = moduleName
+	eja.Action = "save"
+	eja.Id = id
+	eja.Uploads = map[string]*multipart.FileHeader{field: form.File["ejaFile["+field+"]"][0]}
+	return runApi(t, session, eja)
+}
+
+// fieldValue returns the value of the field called name
+func fieldValue(fields []db.TypeField, name string) string {
+	for _, field := range fields {
+		if field.Name == name {
+			return field.Value
+		}
+	}
+	return ""
+}
+
 // TestSet verifies the initialization of API structure
 func TestSet(t *testing.T) {
 	eja := api.Set()
@@ -239,6 +320,34 @@ func TestCRUDOperations(t *testing.T) {
 		}
 	})
 
+	t.Run("Save_Unknown_Field", func(t *testing.T) {
+		eja := api.Set()
+		eja.Session = session
+		eja.ModuleName = "ejaUsers"
+		eja.Action = "new"
+		res, _ := api.Run(eja, true)
+		newId := res.Id
+
+		eja = api.Set()
+		eja.Session = session
+		eja.ModuleName = "ejaUsers"
+		eja.Id = newId
+		eja.Action = "save"
+		eja.Values["username"] = "unknownfield"
+		eja.Values["noSuchField"] = "value"
+
+		res, err := api.Run(eja, true)
+		if err != nil {
+			t.Fatalf("Failed to save record: %v", err)
+		}
+		if res.Values["username"] != "unknownfield" {
+			t.Error("Known fields should still be saved")
+		}
+		if len(res.Alert) == 0 || !strings.Contains(strings.Join(res.Alert, " "), "noSuchField") {
+			t.Error("Expected an alert naming the ignored field", res.Alert)
+		}
+	})
+
 	t.Run("Edit_Record", func(t *testing.T) {
 		// Create and save a record
 		eja := api.Set()
@@ -1421,6 +1530,53 @@ func TestConcurrentOperations(t *testing.T) {
 	})
 }
 
+// TestSharedPool tests concurrent API calls sharing a single database handle
+func TestSharedPool(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	pool := db.Session()
+	if err := pool.Open(sys.Options.DbType, sys.Options.DbName, sys.Options.DbUser, sys.Options.DbPass, sys.Options.DbHost, sys.Options.DbPort); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+	pool.SetPool(4, 4, 0)
+
+	login := api.Set()
+	login.Action = "login"
+	login.Values["username"] = "admin"
+	login.Values["password"] = "secret"
+	res, err := api.Run(login, true, pool)
+	if err != nil || res.Session == "" {
+		t.Fatalf("Login failed: %v", err)
+	}
+	session := res.Session
+
+	done := make(chan bool, 10)
+	for i := range 10 {
+		go func(idx int) {
+			eja := api.Set()
+			eja.Session = session
+			eja.ModuleName = "ejaModules"
+			eja.Action = "search"
+			res, err := api.Run(eja, true, pool)
+			if err != nil {
+				t.Errorf("Pooled request %d failed: %v", idx, err)
+			} else if len(res.SearchRows) == 0 {
+				t.Errorf("Pooled request %d returned no rows", idx)
+			}
+			done <- true
+		}(i)
+	}
+	for range 10 {
+		<-done
+	}
+
+	if err := pool.Handler.Ping(); err != nil {
+		t.Error("Pool should stay open after the requests:", err)
+	}
+}
+
 // TestFullTextSearch tests FTS field creation, indexing, and searching via the API
 func TestFullTextSearch(t *testing.T) {
 	_, cleanup := setupTestDB(t)
@@ -0,0 +1,42 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/db"
+)
+
+// TestSearchTotals tests the column aggregates computed over the whole list result
+func TestSearchTotals(t *testing.T) {
+	_, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := fmt.Sprint(saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testOrders", "sqlCreated": "1"}).Id)
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": moduleId, "name": "title", "type": "text", "powerList": "1", "powerSearch": "1", "aggregate": "count"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": moduleId, "name": "qty", "type": "integer", "powerList": "2", "powerSearch": "2", "aggregate": "sum"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": moduleId, "name": "price", "type": "money", "value": "EUR", "powerList": "3", "aggregate": "avg"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": moduleId, "name": "day", "type": "date", "powerList": "4", "aggregate": "max"})
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": moduleId, "name": "note", "type": "text", "powerList": "5", "aggregate": "sum"})
+	for _, order := range [][]string{{"a", "2", "1.50", "2024-01-05"}, {"b", "3", "2.25", "2024-03-01"}, {"c", "5", "10", "2024-02-10"}} {
+		saveRecord(t, session, "testOrders", 0, map[string]string{"title": order[0], "qty": order[1], "price": order[2], "day": order[3], "note": "x"})
+	}
+
+	res := searchModule(t, session, "testOrders", db.TypeSavedSearchCriteria{Values: map[string]string{"qty.start": "3"}, SearchLimit: 1})
+	if res.SearchCount != 2 || len(res.SearchRows) != 1 {
+		t.Fatal("Search should match two orders on one page", res.SearchCount, res.SearchRows)
+	}
+	want := map[string]string{"title": "2", "qty": "8", "price": "6.13 EUR", "day": "2024-03-01"}
+	for key, value := range want {
+		if res.SearchTotals[key] != value {
+			t.Errorf("Total of %s should be %s over the whole result, got %q", key, value, res.SearchTotals[key])
+		}
+	}
+	if _, ok := res.SearchTotals["note"]; ok {
+		t.Error("Sum should not apply to text fields", res.SearchTotals)
+	}
+}
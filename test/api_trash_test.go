@@ -0,0 +1,99 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestTrash tests soft delete, restore and purge on a module with the trash enabled
+func TestTrash(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	action := func(name string, ids ...int64) api.Api {
+		eja := api.Set()
+		eja.ModuleName = "testTrash"
+		eja.Action = name
+		eja.IdList = ids
+		return runApi(t, session, eja)
+	}
+	hasCommand := func(res api.Api, name string) bool {
+		for _, command := range res.Commands {
+			if command.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testTrash", "sqlCreated": "1", "trash": "1"}).Id
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "title", "type": "text", "powerList": "1"})
+
+	var ids []int64
+	for _, title := range []string{"one", "two"} {
+		ids = append(ids, saveRecord(t, session, "testTrash", 0, map[string]string{"title": title}).Id)
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.LinkAdd(1, moduleId, ids[0], moduleId, ids[1])
+
+	res := action("delete", ids[0])
+	if res.SearchCount != 1 {
+		t.Error("Trashed records should be hidden from the list", res.SearchCount)
+	}
+	if !hasCommand(res, "trash") || hasCommand(res, "restore") {
+		t.Error("List should offer the trash but not restore", res.Commands)
+	}
+	if value, _ := d.Value("SELECT COUNT(*) FROM testTrash WHERE ejaTrash IS NOT NULL"); value != "1" {
+		t.Fatal("Delete should only mark the record", value)
+	}
+	if value, _ := d.Value("SELECT COUNT(*) FROM ejaLinks WHERE srcModuleId=? AND srcFieldId=?", moduleId, ids[0]); value != "1" {
+		t.Error("Trashed records should keep their links", value)
+	}
+
+	res = action("trash")
+	if res.SearchCount != 1 || !res.Trash || !hasCommand(res, "restore") || !hasCommand(res, "purge") || hasCommand(res, "delete") {
+		t.Fatal("Trash should list the deleted record", res.SearchCount, res.Commands)
+	}
+
+	res = action("restore", ids[0])
+	if res.SearchCount != 0 {
+		t.Error("Restored record should leave the trash", res.SearchCount)
+	}
+
+	action("purge", ids[1])
+	if value, _ := d.Value("SELECT COUNT(*) FROM testTrash"); value != "2" {
+		t.Error("Purge should ignore records that are not trashed", value)
+	}
+
+	action("delete", ids[0])
+	action("purge", ids[0])
+	if value, _ := d.Value("SELECT COUNT(*) FROM testTrash"); value != "1" {
+		t.Error("Purge should remove the trashed record", value)
+	}
+	if value, _ := d.Value("SELECT COUNT(*) FROM ejaLinks WHERE srcModuleId=? AND srcFieldId=?", moduleId, ids[0]); value != "0" {
+		t.Error("Purge should remove the links", value)
+	}
+
+	saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": "code", "type": "text", "powerEdit": "1", "valueUnique": "1"})
+	saveRecord(t, session, "testTrash", ids[1], map[string]string{"code": "ABC"})
+	action("delete", ids[1])
+	if res := saveRecord(t, session, "testTrash", 0, map[string]string{"code": "ABC"}); len(res.FieldErrors) > 0 {
+		t.Error("Unique values should not clash with trashed records", res.FieldErrors)
+	}
+
+	if err := d.Purge(1, d.ModuleGetIdByName("ejaUsers"), 1); err == nil {
+		t.Error("Purge on a module without trash should fail")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/eja/tibula/db"
+)
+
+// TestFieldValidation tests the ejaFields validation rules on save and import
+func TestFieldValidation(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testRules", "sqlCreated": "1"}).Id
+	fields := []map[string]string{
+		{"name": "code", "type": "text", "required": "1", "pattern": "[A-Z]{3}", "valueUnique": "1"},
+		{"name": "qty", "type": "integer", "valueMin": "1", "valueMax": "10"},
+		{"name": "note", "type": "text", "lengthMax": "5"},
+	}
+	for _, field := range fields {
+		field["ejaModuleId"] = fmt.Sprint(moduleId)
+		saveRecord(t, session, "ejaFields", 0, field)
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	res := saveRecord(t, session, "testRules", 0, map[string]string{"code": "ABC", "qty": "5", "note": "ok"})
+	if len(res.FieldErrors) > 0 {
+		t.Fatal("Valid record rejected", res.FieldErrors)
+	}
+	validId := res.Id
+
+	cases := []struct {
+		values map[string]string
+		field  string
+	}{
+		{map[string]string{"code": "", "qty": "5"}, "code"},
+		{map[string]string{"code": "abcd"}, "code"},
+		{map[string]string{"code": "ABC"}, "code"},
+		{map[string]string{"code": "XYZ", "qty": "abc"}, "qty"},
+		{map[string]string{"code": "XYZ", "qty": "11"}, "qty"},
+		{map[string]string{"code": "XYZ", "note": "too long"}, "note"},
+	}
+	for _, c := range cases {
+		res := saveRecord(t, session, "testRules", 0, c.values)
+		if res.FieldErrors[c.field] == "" {
+			t.Errorf("Expected an error on %s for %v, got %v", c.field, c.values, res.FieldErrors)
+		}
+		if value, _ := d.Value("SELECT COUNT(*) FROM testRules WHERE code=?", c.values["code"]); c.values["code"] == "XYZ" && value != "0" {
+			t.Errorf("Invalid record should not be saved %v", c.values)
+		}
+	}
+
+	res = saveRecord(t, session, "testRules", validId, map[string]string{"qty": "7"})
+	if len(res.FieldErrors) > 0 {
+		t.Error("Required fields already stored should not be posted again", res.FieldErrors)
+	}
+
+	module := db.TypeModule{
+		Type: "module",
+		Data: []map[string]any{{"code": "DEF"}, {"code": "bad"}},
+	}
+	if err := d.ModuleAppend(module, "testRules"); err == nil {
+		t.Error("Append with invalid data should fail")
+	}
+	if value, _ := d.Value("SELECT COUNT(*) FROM testRules WHERE code='DEF'"); value != "0" {
+		t.Error("Failed append should not leave rows behind", value)
+	}
+
+	exported, _ := d.ModuleExport(moduleId, false)
+	for _, field := range exported.Field {
+		if field.Name == "code" && (field.Required != 1 || field.Pattern != "[A-Z]{3}" || field.ValueUnique != 1) {
+			t.Error("Export should carry the validation rules", field)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (C) by Ubaldo Porcheddu <ubaldo@eja.it>
+
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
+)
+
+// TestSaveConflict tests the rejection of saves based on a stale version of the record
+func TestSaveConflict(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	session := getAuthenticatedSession(t)
+
+	moduleId := saveRecord(t, session, "ejaModules", 0, map[string]string{"name": "testConflict", "sqlCreated": "1"}).Id
+	for name, fieldType := range map[string]string{"title": "text", "amount": "decimal"} {
+		saveRecord(t, session, "ejaFields", 0, map[string]string{"ejaModuleId": fmt.Sprint(moduleId), "name": name, "type": fieldType})
+	}
+
+	eja := api.Set()
+	eja.ModuleName = "testConflict"
+	eja.Action = "new"
+	id := runApi(t, session, eja).Id
+	eja.Action = "edit"
+	eja.Id = id
+	res := runApi(t, session, eja)
+	if res.Version == "" {
+		t.Fatal("Edit should carry the record version")
+	}
+	first, second := res.Version, res.Version
+
+	saveVersion := func(version string, values map[string]string) api.Api {
+		eja := api.Set()
+		eja.ModuleName = "testConflict"
+		eja.Action = "save"
+		eja.Id = id
+		eja.Version = version
+		eja.Values = values
+		return runApi(t, session, eja)
+	}
+
+	res = saveVersion(first, map[string]string{"title": "one", "amount": "1.50"})
+	if len(res.Conflicts) > 0 || len(res.Alert) > 0 || res.Values["title"] != "one" {
+		t.Fatal("Save with the current version should succeed", res.Conflicts, res.Alert)
+	}
+	if res.Version == first {
+		t.Error("Version should change after a save", res.Version)
+	}
+
+	res = saveVersion(second, map[string]string{"title": "two", "amount": "1.5"})
+	if res.Conflicts["title"] != "one" || len(res.Conflicts) != 1 || len(res.Alert) == 0 {
+		t.Fatal("Stale save should be rejected listing the changed fields", res.Conflicts, res.Alert)
+	}
+	if res.Values["title"] != "two" || res.ActionType != "Edit" {
+		t.Error("Rejected save should keep the submitted values", res.Values, res.ActionType)
+	}
+
+	d := db.Session()
+	if err := d.Open("sqlite", dbPath, "", "", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if value, _ := d.Value("SELECT title FROM testConflict WHERE ejaId=?", id); value != "one" {
+		t.Error("Stale save should not be stored", value)
+	}
+
+	res = saveVersion(res.Version, map[string]string{"title": "two"})
+	if len(res.Conflicts) > 0 || res.Values["title"] != "two" {
+		t.Error("Save after the merge should succeed", res.Conflicts, res.Alert)
+	}
+
+	res = saveVersion(second, map[string]string{"title": "two"})
+	if len(res.Conflicts) > 0 {
+		t.Error("Stale save that changes nothing should not conflict", res.Conflicts)
+	}
+	res = saveVersion("", map[string]string{"title": "three"})
+	if len(res.Conflicts) > 0 || res.Values["title"] != "three" {
+		t.Error("Save without a version should not be checked", res.Conflicts)
+	}
+
+	tx, err := d.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Conflicts(1, moduleId, id, res.Version, map[string]string{"title": "four"}); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		_, err := d.Run("UPDATE testConflict SET title='five' WHERE ejaId=?", id)
+		done <- err
+	}()
+	select {
+	case <-done:
+		tx.Rollback()
+		t.Fatal("Checked record should stay locked until the save ends")
+	case <-time.After(300 * time.Millisecond):
+	}
+	tx.Put(1, moduleId, id, "title", "four")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Error("Write after the save should go through", err)
+	}
+}
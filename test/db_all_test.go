@@ -67,7 +67,7 @@ func TestModule(t *testing.T) {
 		if err := db.Put(2, tableId, id, fieldName, "user"); err != nil {
 			t.Fatal(err)
 		}
-		if err := db.Put(2, tableId, id, "defaultModuleId", "3"); err != nil {
+		if err := db.Put(2, tableId, id, "defaultModuleId", db.ModuleGetIdByName("ejaCommands")); err != nil {
 			t.Fatal(err)
 		}
 	})
@@ -3,8 +3,12 @@
 package test
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -222,3 +226,364 @@ func TestDbOperations(t *testing.T) {
 		}
 	})
 }
+
+type testEngine struct {
+	db.TypeEngine
+	opened bool
+}
+
+func (engine *testEngine) Open(database string, username string, password string, host string, port int) (*sql.DB, error) {
+	engine.opened = true
+	return engine.TypeEngine.Open(database, username, password, host, port)
+}
+
+func TestDbEngineRegister(t *testing.T) {
+	engine := &testEngine{TypeEngine: db.Engines["sqlite"]}
+	db.EngineRegister("sqliteTest", engine)
+	defer delete(db.Engines, "sqliteTest")
+
+	session := db.Session()
+	if err := session.Open("sqliteTest", ":memory:", "", "", "", 0); err != nil {
+		t.Fatal("Cannot open database:", err)
+	}
+	defer session.Close()
+
+	if !engine.opened {
+		t.Error("Registered engine was not used")
+	}
+	if err := session.TableAdd("table_engine"); err != nil {
+		t.Error(err)
+	}
+	if err := session.FieldAdd("table_engine", "name", "text"); err != nil {
+		t.Error(err)
+	}
+	if check, err := session.FieldExists("table_engine", "name"); err != nil || !check {
+		t.Error("Field not found", err)
+	}
+
+	if err := session.Open("unknown", ":memory:", "", "", "", 0); err == nil {
+		t.Error("Expected error for unknown engine")
+	}
+}
+
+type postgresTypesEngine struct {
+	db.TypeEngine
+}
+
+func (engine *postgresTypesEngine) FieldType(fieldType string) string {
+	return db.Engines["postgres"].FieldType(fieldType)
+}
+
+// TestDbSchemaDiff tests that retypes are judged on the column types of the engine in use
+func TestDbSchemaDiff(t *testing.T) {
+	dbPath, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.EngineRegister("sqlitePostgresTypes", &postgresTypesEngine{TypeEngine: db.Engines["sqlite"]})
+	defer delete(db.Engines, "sqlitePostgresTypes")
+
+	session := db.Session()
+	if err := session.Open("sqlitePostgresTypes", dbPath, "", "", "", 0); err != nil {
+		t.Fatal("Cannot open database:", err)
+	}
+	defer session.Close()
+
+	modulesId, fieldsId := session.ModuleGetIdByName("ejaModules"), session.ModuleGetIdByName("ejaFields")
+	moduleId, err := session.New(1, modulesId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Put(1, modulesId, moduleId, "name", "testRetype"); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.TableAdd("testRetype"); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]int64{}
+	for name, fieldType := range map[string]string{"note": "text", "payload": "json", "amount": "money"} {
+		if err := session.FieldAdd("testRetype", name, fieldType); err != nil {
+			t.Fatal(err)
+		}
+		if fields[name], err = session.New(1, fieldsId); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range map[string]any{"ejaModuleId": moduleId, "name": name, "type": fieldType} {
+			if err := session.Put(1, fieldsId, fields[name], key, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tests := []struct {
+		field       string
+		newType     string
+		oldSqlType  string
+		newSqlType  string
+		destructive bool
+	}{
+		{"note", "json", "TEXT", "JSONB", true},
+		{"payload", "text", "JSONB", "TEXT", false},
+		{"amount", "text", "BIGINT", "TEXT", false},
+		{"amount", "integer", "BIGINT", "INTEGER", true},
+		{"note", "email", "TEXT", "TEXT", false},
+	}
+	for _, test := range tests {
+		diff, err := session.SchemaDiff(fields[test.field], 0, test.field, test.newType, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff.OldSqlType != test.oldSqlType || diff.NewSqlType != test.newSqlType || diff.Retype != (test.oldSqlType != test.newSqlType) || diff.Destructive() != test.destructive {
+			t.Errorf("%s to %s: %+v, destructive %v", test.field, test.newType, diff, diff.Destructive())
+		}
+	}
+}
+
+func TestDbQueryTimeout(t *testing.T) {
+	pool := db.Session()
+	if err := pool.Open("sqlite", ":memory:", "", "", "", 0); err != nil {
+		t.Fatal("Cannot open database:", err)
+	}
+	defer pool.Close()
+
+	session, err := pool.Conn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	session.QueryTimeout = 100 * time.Millisecond
+
+	endless := "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c"
+	start := time.Now()
+	if _, err := session.Value(endless); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Expected deadline exceeded, got", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Query was not cancelled in time")
+	}
+	if !errors.Is(session.Err(), context.DeadlineExceeded) {
+		t.Error("Timeout not recorded on the session", session.Err())
+	}
+
+	if value, err := session.Value("SELECT 1"); err != nil || value != "1" {
+		t.Error("Session should be usable after a timeout", value, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := session.RowsContext(ctx, "SELECT 1"); !errors.Is(err, context.Canceled) {
+		t.Error("Expected cancelled query, got", err)
+	}
+}
+
+func TestDbTransactions(t *testing.T) {
+	session := db.Session()
+	if err := session.Open("sqlite", ":memory:", "", "", "", 0); err != nil {
+		t.Fatal("Cannot open database:", err)
+	}
+	defer session.Close()
+
+	if err := session.Setup(""); err != nil {
+		t.Fatal("Setup error", err)
+	}
+	count := func(table string) string {
+		value, _ := session.Value("SELECT COUNT(*) FROM " + table)
+		return value
+	}
+
+	t.Run("Commit", func(t *testing.T) {
+		err := session.WithTx(func(tx *db.TypeSession) error {
+			_, err := tx.Run("INSERT INTO ejaGroups (ejaOwner, ejaLog, name) VALUES (1,?,?)", tx.Now(), "committed")
+			return err
+		})
+		if err != nil || count("ejaGroups WHERE name='committed'") != "1" {
+			t.Error("Transaction not committed", err)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		err := session.WithTx(func(tx *db.TypeSession) error {
+			tx.Run("INSERT INTO ejaGroups (ejaOwner, ejaLog, name) VALUES (1,?,?)", tx.Now(), "rolledBack")
+			return tx.WithTx(func(nested *db.TypeSession) error {
+				return errors.New("failure")
+			})
+		})
+		if err == nil || count("ejaGroups WHERE name='rolledBack'") != "0" {
+			t.Error("Transaction not rolled back", err)
+		}
+	})
+
+	t.Run("BeginCommit", func(t *testing.T) {
+		tx, err := session.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tx.InTx() || session.InTx() {
+			t.Error("Only the returned session should be in a transaction")
+		}
+		if _, err := tx.Begin(); err == nil {
+			t.Error("Expected error on nested Begin")
+		}
+		tx.Run("INSERT INTO ejaGroups (ejaOwner, ejaLog, name) VALUES (1,?,?)", tx.Now(), "manual")
+		if err := tx.Commit(); err != nil {
+			t.Error(err)
+		}
+		if err := tx.Rollback(); err == nil {
+			t.Error("Expected error on Rollback after Commit")
+		}
+		if count("ejaGroups WHERE name='manual'") != "1" {
+			t.Error("Manual transaction not committed")
+		}
+	})
+
+	t.Run("ModuleImportAtomic", func(t *testing.T) {
+		modules := count("ejaModules")
+		module := db.TypeModule{
+			Name:   "brokenImport",
+			Type:   "module",
+			Module: db.TypeModuleModule{SqlCreated: 1},
+			Field: []db.TypeModuleField{
+				{Name: "good", Type: "text"},
+				{Name: "bad name", Type: "text"},
+			},
+		}
+		if err := session.ModuleImport(module, ""); err == nil {
+			t.Error("Expected import error")
+		}
+		if count("ejaModules") != modules || session.ModuleGetIdByName("brokenImport") != 0 {
+			t.Error("Failed import left a module behind")
+		}
+		if check, _ := session.TableExists("brokenImport"); check {
+			t.Error("Failed import left a table behind")
+		}
+	})
+}
+
+func TestDbQueryResult(t *testing.T) {
+	session := db.Session()
+	if err := session.Open("sqlite", ":memory:", "", "", "", 0); err != nil {
+		t.Fatal("Cannot open database:", err)
+	}
+	defer session.Close()
+
+	session.TableAdd("table_result")
+	session.FieldAdd("table_result", "name", "text")
+	session.FieldAdd("table_result", "amount", "decimal")
+	session.FieldAdd("table_result", "quantity", "integer")
+	session.Run("INSERT INTO table_result (ejaOwner, ejaLog, name, amount, quantity) VALUES (1,?,?,?,?)", session.Now(), "", 1.5, 3)
+	session.Run("INSERT INTO table_result (ejaOwner, ejaLog, name, amount, quantity) VALUES (1,?,NULL,NULL,NULL)", session.Now())
+
+	result, err := session.Query("SELECT quantity, name, amount, ejaId FROM table_result ORDER BY ejaId")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cols := result.Cols(); len(cols) != 4 || cols[0] != "quantity" || cols[3] != "ejaId" {
+		t.Error("Column order not preserved", cols)
+	}
+	if result.Columns[0].Type != "integer" || result.Columns[1].Type != "text" || result.Columns[2].Type != "decimal" {
+		t.Error("Unexpected column types", result.Columns)
+	}
+	if len(result.Rows) != 2 {
+		t.Fatal("Expected 2 rows, got", len(result.Rows))
+	}
+	if result.Rows[0][1].Null || !result.Rows[1][1].Null {
+		t.Error("NULL and empty string are not told apart", result.Rows)
+	}
+
+	record := result.Record(0)
+	if record["quantity"] != int64(3) || record["amount"] != 1.5 || record["name"] != "" {
+		t.Error("Unexpected typed record", record)
+	}
+	if record := result.Record(1); record["quantity"] != nil || record["name"] != nil {
+		t.Error("NULL values should be nil", record)
+	}
+
+	if rows := result.Maps(); len(rows) != 2 || rows[0]["quantity"] != "3" || rows[1]["name"] != "" {
+		t.Error("Compatibility rows differ", rows)
+	}
+}
+
+type countingEngine struct {
+	db.TypeEngine
+	queries map[string]int
+}
+
+func (engine *countingEngine) count(query string) {
+	for _, table := range []string{"table_page"} {
+		if strings.Contains(query, table) {
+			engine.queries[table]++
+		}
+	}
+}
+
+func (engine *countingEngine) Query(session *db.TypeSession, query string, args ...any) (db.TypeResult, error) {
+	engine.count(query)
+	return engine.TypeEngine.Query(session, query, args...)
+}
+
+func (engine *countingEngine) Value(session *db.TypeSession, query string, args ...any) (string, error) {
+	engine.count(query)
+	return engine.TypeEngine.Value(session, query, args...)
+}
+
+func (engine *countingEngine) Rows(session *db.TypeSession, query string, args ...any) (db.TypeRows, error) {
+	engine.count(query)
+	return engine.TypeEngine.Rows(session, query, args...)
+}
+
+func (engine *countingEngine) Cols(session *db.TypeSession, query string, args ...any) ([]string, error) {
+	engine.count(query)
+	return engine.TypeEngine.Cols(session, query, args...)
+}
+
+func TestDbSearchPage(t *testing.T) {
+	engine := &countingEngine{TypeEngine: db.Engines["sqlite"], queries: map[string]int{}}
+	db.EngineRegister("sqliteCount", engine)
+	defer delete(db.Engines, "sqliteCount")
+
+	session := db.Session()
+	if err := session.Open("sqliteCount", ":memory:", "", "", "", 0); err != nil {
+		t.Fatal("Cannot open database:", err)
+	}
+	defer session.Close()
+	if err := session.Setup(""); err != nil {
+		t.Fatal("Setup error", err)
+	}
+
+	session.TableAdd("table_page")
+	session.FieldAdd("table_page", "name", "text")
+	for i := range 25 {
+		session.Run("INSERT INTO table_page (ejaOwner, ejaLog, name) VALUES (1,?,?)", session.Now(), fmt.Sprintf("row%02d", i))
+	}
+	engine.queries["table_page"] = 0
+
+	query := "SELECT ejaId, name FROM table_page WHERE ejaOwner IN (1) "
+	result, _, count, err := session.SearchPage(1, 0, query, "name ASC", 10, 20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 25 || len(result.Rows) != 5 {
+		t.Error("Unexpected page", count, len(result.Rows))
+	}
+	if cols := result.Cols(); len(cols) != 2 || cols[0] != "ejaId" || cols[1] != "name" {
+		t.Error("Count column should not be returned", cols)
+	}
+	if result.Map(0)["name"] != "row20" {
+		t.Error("Unexpected first row", result.Map(0))
+	}
+	if engine.queries["table_page"] != 1 {
+		t.Error("Expected a single round trip, got", engine.queries["table_page"])
+	}
+
+	if _, _, count, _ := session.SearchPage(1, 0, query, "name ASC", 10, 30, nil); count != 25 {
+		t.Error("Count should be kept past the last page", count)
+	}
+
+	engine.queries["table_page"] = 0
+	if options := session.SelectSqlToRows("SELECT ejaId, name FROM table_page ORDER BY ejaId LIMIT 2"); len(options) != 2 || options[1].Value != "row01" {
+		t.Error("Unexpected options", options)
+	}
+	if engine.queries["table_page"] != 1 {
+		t.Error("Options query should run once, got", engine.queries["table_page"])
+	}
+}
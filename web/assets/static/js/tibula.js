@@ -154,7 +154,54 @@ document.querySelectorAll('select[multiple]').forEach(select => {
   });
 });
 
+function filterAdd(obj, template) {
+  var group = obj.closest('.ejaFilterGroup')
+  group.querySelector('.ejaFilterItems').appendChild(document.getElementById(template).content.cloneNode(true))
+  return false
+}
+
+function filterRemove(obj) {
+  obj.closest('.ejaFilterRow, .ejaFilterGroup').remove()
+  return false
+}
+
+function filterBuild(group) {
+  var filter = {
+    Logic: group.querySelector(':scope > div > .ejaFilterLogic').value,
+    Not: group.querySelector(':scope > div > .ejaFilterNot').checked,
+    Filters: []
+  }
+  group.querySelector(':scope > .ejaFilterItems').childNodes.forEach(function(item) {
+    if (item.classList?.contains('ejaFilterGroup')) {
+      var child = filterBuild(item)
+      if (child.Filters.length > 0) {
+        filter.Filters.push(child)
+      }
+    } else if (item.classList?.contains('ejaFilterRow')) {
+      var op = item.querySelector('.ejaFilterOp').value
+      var value = item.querySelector('.ejaFilterValue').value
+      var leaf = {Field: item.querySelector('.ejaFilterField').value, Op: op, Not: item.querySelector('.ejaFilterNot').checked}
+      if (op == 'in' || op == 'notIn' || op == 'between') {
+        leaf.Values = value.split(',').map(v => v.trim())
+      } else {
+        leaf.Value = value
+      }
+      filter.Filters.push(leaf)
+    }
+  })
+  return filter
+}
+
+function filterSave() {
+  var root = document.getElementById('ejaFilterRoot')
+  if (root) {
+    var filter = filterBuild(root)
+    document.getElementById('ejaFilter').value = filter.Filters.length > 0 ? JSON.stringify(filter) : ''
+  }
+}
+
 document.getElementById('ejaForm')?.addEventListener('submit', function() {
+  filterSave();
   this.querySelectorAll('select').forEach(select => {
     if (select.selectedIndex === -1 || select.value === '') {
       select.value = '';
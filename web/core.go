@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"html/template"
 	"log/slog"
+	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"strings"
@@ -76,7 +77,8 @@ func Core(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, msg, http.StatusBadRequest)
 			return
 		}
-		eja, err = api.Run(eja, false)
+		eja.RemoteIP = clientIP
+		eja, err = api.RunContext(r.Context(), eja, false, dbPool)
 		updateLoginTracker(clientIP, eja.Action, err)
 		if err != nil {
 			if err.Error() == "ejaNotAuthorized" {
@@ -86,6 +88,8 @@ func Core(w http.ResponseWriter, r *http.Request) {
 				slog.Error("API process error", "address", r.RemoteAddr, "error", err)
 				http.Error(w, "API process error", http.StatusInternalServerError)
 			}
+		} else if eja.File.Hash != "" {
+			fileServe(w, r, eja.File)
 		} else {
 			eja.SqlQuery = ""
 			eja.SqlQuery64 = ""
@@ -97,6 +101,9 @@ func Core(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
 			w.Header().Set("Content-Type", "application/json")
+			if len(eja.Conflicts) > 0 {
+				w.WriteHeader(http.StatusConflict)
+			}
 			if _, err = w.Write(jsonData); err != nil {
 				slog.Error("cannot return json data", "error", err)
 			}
@@ -134,6 +141,13 @@ func Core(w http.ResponseWriter, r *http.Request) {
 				}
 			case "ejaSubModulePath":
 				eja.SubModulePath = subModulePathExtract(value)
+			case "ejaFile":
+				eja.Action = "edit"
+				eja.FieldFile = value
+			case "ejaThumb":
+				eja.FileThumb = sys.Number(value) > 0
+			case "ejaSearchId":
+				eja.SearchId = sys.Number(value)
 			}
 		}
 
@@ -157,6 +171,23 @@ func Core(w http.ResponseWriter, r *http.Request) {
 				}
 			case "ejaSubModulePath":
 				eja.SubModulePath = subModulePathExtract(value)
+			case "ejaVersion":
+				eja.Version = value
+			case "ejaConfirm":
+				eja.Confirm = sys.Number(value) > 0
+			case "ejaSearchName":
+				eja.SearchName = value
+			case "ejaFilter":
+				var filter db.TypeFilter
+				if value != "" && json.Unmarshal([]byte(value), &filter) == nil {
+					eja.Filter = &filter
+				}
+			case "ejaAuditRestore":
+				if mode, id, ok := strings.Cut(value, "."); ok {
+					eja.Action = "history"
+					eja.AuditId = sys.Number(id)
+					eja.AuditVersion = mode == "version"
+				}
 			}
 		}
 		for key, value := range r.Form {
@@ -184,10 +215,21 @@ func Core(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		if r.MultipartForm != nil {
+			for key, uploads := range r.MultipartForm.File {
+				if strings.HasPrefix(key, "ejaFile") && len(uploads) > 0 && uploads[0].Filename != "" {
+					if eja.Uploads == nil {
+						eja.Uploads = make(map[string]*multipart.FileHeader)
+					}
+					eja.Uploads[arrayKeyNameExtract(key)] = uploads[0]
+				}
+			}
+		}
+
 		if len(r.Form) == 0 {
 			err = nil
 		} else {
-			eja, err = api.Run(eja, true)
+			eja, err = api.RunContext(r.Context(), eja, true, dbPool)
 			updateLoginTracker(clientIP, eja.Action, err)
 			if err != nil {
 				if err.Error() == "ejaNotAuthorized" {
@@ -195,6 +237,9 @@ func Core(w http.ResponseWriter, r *http.Request) {
 				} else {
 					slog.Error("API process error", "address", r.RemoteAddr, "error", err)
 				}
+			} else if eja.File.Hash != "" {
+				fileServe(w, r, eja.File)
+				return
 			} else {
 				templateFile = eja.ActionType + ".html"
 			}
@@ -206,7 +251,9 @@ func Core(w http.ResponseWriter, r *http.Request) {
 
 		var tpl *template.Template
 		templateFunctions := template.FuncMap{
+			"contactLink": contactLink,
 			"csvContains": csvContains,
+			"fileInfo":    fileInfo,
 			"safe":        func(s string) template.HTML { return template.HTML(s) },
 		}
 		if sys.Options.WebPath != "" {
@@ -11,7 +11,10 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
 	"github.com/eja/tibula/sys"
 )
 
@@ -22,10 +25,22 @@ var Router = http.NewServeMux()
 var RouterPathCore = "/"
 var RouterPathStatic = "/static/"
 
+var dbPool api.DbSession
+
 func Start() error {
 
 	address := fmt.Sprintf("%s:%d", sys.Options.WebHost, sys.Options.WebPort)
 
+	dbPool = api.DbProvider()
+	if err := dbPool.Open(sys.Options.DbType, sys.Options.DbName, sys.Options.DbUser, sys.Options.DbPass, sys.Options.DbHost, sys.Options.DbPort); err != nil {
+		return err
+	}
+	defer dbPool.Close()
+	if sys.Options.FilesPath != "" {
+		db.FilesPath = sys.Options.FilesPath
+	}
+	dbPool.SetPool(sys.Options.DbMaxOpen, sys.Options.DbMaxIdle, time.Duration(sys.Options.DbMaxLifetime)*time.Second)
+
 	Router.HandleFunc(RouterPathCore, Core)
 
 	if sys.Options.WebPath != "" {
@@ -5,6 +5,8 @@ package web
 import (
 	"encoding/csv"
 	"encoding/json"
+	"html/template"
+	"mime"
 	"net"
 	"net/http"
 	"regexp"
@@ -13,6 +15,7 @@ import (
 	"strings"
 
 	"github.com/eja/tibula/api"
+	"github.com/eja/tibula/db"
 )
 
 func arrayKeyNameExtract(input string) string {
@@ -82,3 +85,37 @@ func getClientIP(r *http.Request) string {
 	}
 	return ip
 }
+
+// fileInfo returns the metadata of a file field value for the templates, nil
+// when the field is empty.
+func fileInfo(value string) *db.TypeFile {
+	if file, ok := db.FileParse(value); ok {
+		return &file
+	}
+	return nil
+}
+
+// fileServe sends an attachment, as a download so that uploaded pages
+// and scripts are never rendered by the browser. Only JPEG and PNG images are
+// shown inline, so they can be used in <img> tags.
+func fileServe(w http.ResponseWriter, r *http.Request, file db.TypeFile) {
+	contentType := file.Mime
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	disposition := "attachment"
+	if contentType == "image/jpeg" || contentType == "image/png" {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": file.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, file.Path())
+}
+
+// contactLink returns the mailto, tel or web address of a contact field for
+// the list, tel is not among the schemes templates trust so the address is
+// passed as already checked.
+func contactLink(fieldType string, value string) template.URL {
+	return template.URL(db.ContactLink(fieldType, value))
+}